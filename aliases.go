@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+)
+
+type AliasInfo struct {
+	Alias      string `json:"alias"`
+	Collection string `json:"collection"`
+}
+
+// aliasesHandler lists aliases on GET and creates or repoints one on POST.
+func aliasesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		listAliasesHandler(w, r)
+	case http.MethodPost:
+		if authorizeScope(w, r, scopeAdmin) && authorizeUntenanted(w, r, "change aliases") {
+			setAliasHandler(w, r)
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func listAliasesHandler(w http.ResponseWriter, r *http.Request) {
+	registry.InvalidateAliases()
+	aliases := registry.Aliases()
+
+	id := IdentityFrom(r.Context())
+	result := make([]AliasInfo, 0, len(aliases))
+	for alias, collection := range aliases {
+		if !id.CanAccess(alias) {
+			continue
+		}
+		result = append(result, AliasInfo{Alias: alias, Collection: collection})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Alias < result[j].Alias
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func setAliasHandler(w http.ResponseWriter, r *http.Request) {
+	var payload AliasInfo
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.Alias == "" || payload.Collection == "" {
+		http.Error(w, "Invalid JSON or missing fields 'alias' and 'collection'", http.StatusBadRequest)
+		return
+	}
+	// An alias may only be pointed by a caller allowed on both ends.
+	if !authorizeCollections(w, r, payload.Alias, payload.Collection) {
+		return
+	}
+
+	// Aliases always point at a real collection, never at another alias.
+	collection := registry.Resolve(payload.Collection)
+	if _, err := registry.Get(r.Context(), collection); err != nil {
+		if errors.Is(err, ErrCollectionNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Failed to fetch collection: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	previous := registry.Aliases()[payload.Alias]
+	if err := SwapQdrantAlias(r.Context(), payload.Alias, collection); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to update alias: %v", err), http.StatusInternalServerError)
+		return
+	}
+	registry.InvalidateAliases()
+
+	if previous != "" {
+		log.Printf("Alias %s repointed from %s to %s", payload.Alias, previous, collection)
+	} else {
+		log.Printf("Alias %s created for %s", payload.Alias, collection)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"alias":      payload.Alias,
+		"collection": collection,
+		"previous":   previous,
+	})
+}
+
+func deleteAliasHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	alias := r.PathValue("alias")
+	if !authorizeCollections(w, r, alias) || !authorizeUntenanted(w, r, "change aliases") {
+		return
+	}
+	registry.InvalidateAliases()
+	if _, ok := registry.Aliases()[alias]; !ok {
+		http.Error(w, fmt.Sprintf("Alias %q does not exist", alias), http.StatusNotFound)
+		return
+	}
+
+	if err := DeleteQdrantAlias(r.Context(), alias); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to delete alias: %v", err), http.StatusInternalServerError)
+		return
+	}
+	registry.InvalidateAliases()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"status":"deleted"}`))
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const defaultAskContextTokens = 3000
+const askAnswerTokens = 1024
+
+var askSystemPrompt = `You answer questions using only the numbered sources provided.
+Cite every claim with the source number in square brackets, e.g. [1] or [2][3].
+If the sources do not contain the answer, say that you don't know. Do not use outside knowledge.`
+
+var citationRegex = regexp.MustCompile(`\[(\d+)\]`)
+
+type Citation struct {
+	Ref        int         `json:"ref"`
+	PointID    interface{} `json:"point_id"`
+	Collection string      `json:"collection,omitempty"`
+	Origin     string      `json:"origin"`
+	LineStart  int         `json:"line_start,omitempty"`
+	LineEnd    int         `json:"line_end,omitempty"`
+	Score      float64     `json:"score"`
+}
+
+// askProvider returns the chat endpoint used for answers, configurable via ASK_API_URL, ASK_MODEL and ASK_API_KEY_ENV.
+func askProvider(model string) ChatProvider {
+	provider := groqProvider
+	if url := os.Getenv("ASK_API_URL"); url != "" {
+		provider.URL = url
+	}
+	if envModel := os.Getenv("ASK_MODEL"); envModel != "" {
+		provider.Model = envModel
+	}
+	if keyEnv := os.Getenv("ASK_API_KEY_ENV"); keyEnv != "" {
+		provider.APIKeyEnv = keyEnv
+	}
+	if model != "" {
+		provider.Model = model
+	}
+	return provider
+}
+
+// BuildAskContext numbers hits as sources until the token budget, counted for model, is spent.
+func BuildAskContext(hits []SearchHit, model string, maxTokens int) (string, []Citation) {
+	var builder strings.Builder
+	var citations []Citation
+	used := 0
+
+	for _, hit := range hits {
+		text := payloadString(hit.Payload, "text")
+		lineStart, _ := payloadInt(hit.Payload, "line_start")
+		lineEnd, _ := payloadInt(hit.Payload, "line_end")
+		if hit.Passage != nil {
+			text = hit.Passage.Text
+			lineStart, lineEnd = hit.Passage.LineStart, hit.Passage.LineEnd
+		}
+
+		ref := len(citations) + 1
+		origin := hitOrigin(hit)
+		source := fmt.Sprintf("[%d] (%s, lines %d-%d)\n%s\n\n", ref, origin, lineStart, lineEnd, text)
+
+		tokens := CountTokens(model, source)
+		if used+tokens > maxTokens {
+			break
+		}
+		used += tokens
+
+		builder.WriteString(source)
+		citations = append(citations, Citation{
+			Ref:        ref,
+			PointID:    hit.ID,
+			Collection: hit.Collection,
+			Origin:     origin,
+			LineStart:  lineStart,
+			LineEnd:    lineEnd,
+			Score:      hit.Score,
+		})
+	}
+
+	return builder.String(), citations
+}
+
+// citedSources keeps the citations referenced in the answer, or all of them if none are.
+func citedSources(answer string, citations []Citation) []Citation {
+	refs := map[int]bool{}
+	for _, match := range citationRegex.FindAllStringSubmatch(answer, -1) {
+		if ref, err := strconv.Atoi(match[1]); err == nil {
+			refs[ref] = true
+		}
+	}
+
+	var cited []Citation
+	for _, citation := range citations {
+		if refs[citation.Ref] {
+			cited = append(cited, citation)
+		}
+	}
+	if len(cited) == 0 {
+		return citations
+	}
+	return cited
+}
+
+func askHandler(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Question         string `json:"question"`
+		Model            string `json:"model,omitempty"`
+		MaxContextTokens int    `json:"max_context_tokens,omitempty"`
+		Stream           bool   `json:"stream,omitempty"`
+		lookupParams
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.Question == "" {
+		http.Error(w, "Invalid JSON or missing 'question' field", http.StatusBadRequest)
+		return
+	}
+	if !authorizeCollections(w, r, payload.requested()...) {
+		return
+	}
+
+	collections, filter, opts, err := payload.resolve()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	maxContextTokens := payload.MaxContextTokens
+	if maxContextTokens <= 0 {
+		maxContextTokens = defaultAskContextTokens
+	}
+
+	log.Printf("Answering question: %s from collections: %s", payload.Question, strings.Join(collections, ", "))
+
+	hits, err := Lookup(r.Context(), payload.Question, collections, filter, opts)
+	if errors.Is(err, ErrCollectionNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Lookup failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	provider := askProvider(payload.Model)
+	sources, citations := BuildAskContext(hits, provider.Model, maxContextTokens)
+	messages := []ChatMessage{
+		{Role: "system", Content: askSystemPrompt},
+		{Role: "user", Content: fmt.Sprintf("Sources:\n\n%s\nQuestion: %s", sources, payload.Question)},
+	}
+
+	stream := payload.Stream || strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+	if stream {
+		streamAnswer(r.Context(), w, provider, messages, citations)
+		return
+	}
+
+	answer, err := ChatCompletion(r.Context(), provider, messages, 0.1, askAnswerTokens)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Answer generation failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"answer":    answer,
+		"model":     provider.Model,
+		"citations": citedSources(answer, citations),
+	}); err != nil {
+		log.Printf("Error writing response: %v", err)
+	}
+}
+
+// streamAnswer relays answer tokens as server-sent events, followed by a citations event.
+func streamAnswer(ctx context.Context, w http.ResponseWriter, provider ChatProvider, messages []ChatMessage, citations []Citation) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	var answer strings.Builder
+	err := StreamChatCompletion(ctx, provider, messages, 0.1, askAnswerTokens, func(token string) error {
+		answer.WriteString(token)
+		if err := writeSSE(w, "token", map[string]string{"token": token}); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error streaming answer: %v", err)
+		writeSSE(w, "error", map[string]string{"error": err.Error()})
+		flusher.Flush()
+		return
+	}
+
+	writeSSE(w, "citations", citedSources(answer.String(), citations))
+	writeSSE(w, "done", map[string]string{"model": provider.Model})
+	flusher.Flush()
+}
+
+func writeSSE(w http.ResponseWriter, event string, data interface{}) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, jsonData)
+	return err
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Scopes, each granting everything the ones before it do.
+const (
+	scopeRead  = "read"
+	scopeWrite = "write"
+	scopeAdmin = "admin"
+)
+
+var scopeLevels = map[string]int{scopeRead: 1, scopeWrite: 2, scopeAdmin: 3}
+
+var errUnauthenticated = errors.New("missing or invalid credentials")
+
+// Write keys fill existing collections; creating one, whether explicitly, through
+// /chunk's create_collection or by importing into a missing collection, is admin only.
+var errCreateNeedsAdmin = errors.New("creating collections needs the admin scope")
+
+// APIKey is one entry of the AUTH_KEYS_FILE JSON array.
+type APIKey struct {
+	Name        string   `json:"name"`
+	Key         string   `json:"key,omitempty"`         // The key itself, or
+	KeySHA256   string   `json:"key_sha256,omitempty"`  // its hex SHA-256 so the file holds no secrets
+	Scopes      []string `json:"scopes"`                // read, write or admin
+	Collections []string `json:"collections,omitempty"` // Names or path.Match patterns like "team-a-*", empty for all
+	Tenant      string   `json:"tenant_id,omitempty"`   // Confines the key to one tenant's points
+}
+
+// Identity is who a request authenticated as and what it may touch.
+type Identity struct {
+	Name        string
+	Scopes      []string
+	Collections []string
+	Tenant      string
+}
+
+// HasScope reports whether the identity was granted scope or a higher one.
+// A nil identity means authentication is off and allows everything.
+func (id *Identity) HasScope(scope string) bool {
+	if id == nil {
+		return true
+	}
+	for _, granted := range id.Scopes {
+		if scopeLevels[granted] >= scopeLevels[scope] {
+			return true
+		}
+	}
+	return false
+}
+
+// CanAccess reports whether collection, or the collection an alias of that name
+// points at, is on the identity's allow-list, so a key for "docs" keeps working
+// when docs becomes an alias swapped between versions. Only admins may point an
+// alias, at both ends, so a matching alias name can't be aimed elsewhere by a
+// restricted key. "" stands for the default collection.
+func (id *Identity) CanAccess(collection string) bool {
+	if id == nil || len(id.Collections) == 0 {
+		return true
+	}
+	if collection == "" {
+		collection = registry.Default()
+	}
+	for _, name := range []string{collection, registry.Resolve(collection)} {
+		for _, pattern := range id.Collections {
+			if matched, _ := path.Match(pattern, name); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Authenticator checks API keys and HS256-signed bearer JWTs.
+type Authenticator struct {
+	keys        []APIKey // KeySHA256 always set
+	jwtSecret   []byte
+	jwtIssuer   string
+	jwtAudience string
+}
+
+// LoadAuthenticator reads keys from AUTH_KEYS_FILE and JWT settings from JWT_SECRET,
+// JWT_ISSUER and JWT_AUDIENCE. It returns nil when neither keys nor a secret are set,
+// which turns authentication off.
+func LoadAuthenticator() (*Authenticator, error) {
+	auth := &Authenticator{
+		jwtSecret:   []byte(os.Getenv("JWT_SECRET")),
+		jwtIssuer:   os.Getenv("JWT_ISSUER"),
+		jwtAudience: os.Getenv("JWT_AUDIENCE"),
+	}
+
+	if file := os.Getenv("AUTH_KEYS_FILE"); file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read auth keys: %w", err)
+		}
+		if err := json.Unmarshal(data, &auth.keys); err != nil {
+			return nil, fmt.Errorf("failed to parse auth keys: %w", err)
+		}
+	}
+
+	for i, key := range auth.keys {
+		if key.Name == "" {
+			return nil, fmt.Errorf("auth key %d has no name", i)
+		}
+		if key.KeySHA256 == "" {
+			if key.Key == "" {
+				return nil, fmt.Errorf("auth key %s has neither 'key' nor 'key_sha256'", key.Name)
+			}
+			sum := sha256.Sum256([]byte(key.Key))
+			auth.keys[i].KeySHA256 = hex.EncodeToString(sum[:])
+		}
+		auth.keys[i].KeySHA256 = strings.ToLower(auth.keys[i].KeySHA256)
+		auth.keys[i].Key = ""
+		if err := validateScopes(key.Scopes); err != nil {
+			return nil, fmt.Errorf("auth key %s: %w", key.Name, err)
+		}
+		if key.Tenant != "" && !validTenant.MatchString(key.Tenant) {
+			return nil, fmt.Errorf("auth key %s: %w %q", key.Name, errTenantInvalid, key.Tenant)
+		}
+	}
+
+	if len(auth.keys) == 0 && len(auth.jwtSecret) == 0 {
+		return nil, nil
+	}
+	return auth, nil
+}
+
+func validateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("no scopes")
+	}
+	for _, scope := range scopes {
+		if scopeLevels[scope] == 0 {
+			return fmt.Errorf("unknown scope %q, expected read, write or admin", scope)
+		}
+	}
+	return nil
+}
+
+// Authenticate reads credentials from "Authorization: Bearer" or "X-API-Key".
+// Bearer tokens shaped like a JWT are verified as one when JWT_SECRET is set.
+func (a *Authenticator) Authenticate(r *http.Request) (*Identity, error) {
+	token := r.Header.Get("X-API-Key")
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		token = strings.TrimSpace(bearer)
+	}
+	if token == "" {
+		return nil, errUnauthenticated
+	}
+
+	if len(a.jwtSecret) > 0 && strings.Count(token, ".") == 2 {
+		return a.verifyJWT(token)
+	}
+
+	sum := sha256.Sum256([]byte(token))
+	digest := []byte(hex.EncodeToString(sum[:]))
+	for _, key := range a.keys {
+		if subtle.ConstantTimeCompare(digest, []byte(key.KeySHA256)) == 1 {
+			return &Identity{Name: key.Name, Scopes: key.Scopes, Collections: key.Collections, Tenant: key.Tenant}, nil
+		}
+	}
+	return nil, errUnauthenticated
+}
+
+// jwtClaims are the claims Chisel reads. Scopes come from "scope" (space separated)
+// or "scopes", the allow-list from "collections", the tenant from "tenant_id".
+type jwtClaims struct {
+	Subject     string          `json:"sub"`
+	Issuer      string          `json:"iss"`
+	Audience    json.RawMessage `json:"aud"` // A string or a list of strings
+	ExpiresAt   int64           `json:"exp"`
+	NotBefore   int64           `json:"nbf"`
+	Scope       string          `json:"scope"`
+	Scopes      []string        `json:"scopes"`
+	Collections []string        `json:"collections"`
+	Tenant      string          `json:"tenant_id"`
+}
+
+func (a *Authenticator) verifyJWT(token string) (*Identity, error) {
+	parts := strings.Split(token, ".")
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil || header.Alg != "HS256" {
+		return nil, errUnauthenticated
+	}
+
+	mac := hmac.New(sha256.New, a.jwtSecret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, errUnauthenticated
+	}
+
+	var claims jwtClaims
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, errUnauthenticated
+	}
+	now := time.Now().Unix()
+	if claims.ExpiresAt == 0 || now >= claims.ExpiresAt || now < claims.NotBefore {
+		return nil, errUnauthenticated
+	}
+	if a.jwtIssuer != "" && claims.Issuer != a.jwtIssuer {
+		return nil, errUnauthenticated
+	}
+	if a.jwtAudience != "" && !audienceContains(claims.Audience, a.jwtAudience) {
+		return nil, errUnauthenticated
+	}
+
+	// Tokens may carry scopes for other services; keep ours.
+	var scopes []string
+	for _, scope := range append(strings.Fields(claims.Scope), claims.Scopes...) {
+		if scopeLevels[scope] > 0 {
+			scopes = append(scopes, scope)
+		}
+	}
+	if claims.Subject == "" || len(scopes) == 0 {
+		return nil, errUnauthenticated
+	}
+	if claims.Tenant != "" && !validTenant.MatchString(claims.Tenant) {
+		return nil, errUnauthenticated
+	}
+	return &Identity{Name: claims.Subject, Scopes: scopes, Collections: claims.Collections, Tenant: claims.Tenant}, nil
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func audienceContains(raw json.RawMessage, audience string) bool {
+	var single string
+	if json.Unmarshal(raw, &single) == nil {
+		return single == audience
+	}
+	var list []string
+	json.Unmarshal(raw, &list)
+	for _, candidate := range list {
+		if candidate == audience {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticator is set in main; nil leaves every endpoint open.
+var authenticator *Authenticator
+
+type identityKey struct{}
+
+// IdentityFrom returns the identity requireScope attached to ctx, nil when auth is off.
+func IdentityFrom(ctx context.Context) *Identity {
+	id, _ := ctx.Value(identityKey{}).(*Identity)
+	return id
+}
+
+// requireScope authenticates the request and rejects it unless it carries scope.
+// It also settles the tenant the request acts for.
+func requireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+
+		var id *Identity
+		if authenticator != nil {
+			var err error
+			id, err = authenticator.Authenticate(r)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="chisel"`)
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			if !id.HasScope(scope) {
+				http.Error(w, fmt.Sprintf("Key %q lacks the %s scope", id.Name, scope), http.StatusForbidden)
+				return
+			}
+			ctx = context.WithValue(ctx, identityKey{}, id)
+		}
+
+		tenant, err := requestTenant(r, id)
+		if errors.Is(err, errTenantMismatch) || errors.Is(err, errTenantForbidden) || errors.Is(err, errTenantUnbound) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if tenant != "" {
+			ctx = context.WithValue(ctx, tenantKey{}, tenant)
+		}
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+}
+
+// authorizeScope is for handlers whose methods need more than the route's scope.
+// It writes a 403 and returns false when the caller lacks scope.
+func authorizeScope(w http.ResponseWriter, r *http.Request, scope string) bool {
+	if id := IdentityFrom(r.Context()); !id.HasScope(scope) {
+		http.Error(w, fmt.Sprintf("Key %q lacks the %s scope", id.Name, scope), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// authorizeCollections writes a 403 and returns false unless the caller may use
+// every one of the named collections.
+func authorizeCollections(w http.ResponseWriter, r *http.Request, collections ...string) bool {
+	id := IdentityFrom(r.Context())
+	for _, collection := range collections {
+		if !id.CanAccess(collection) {
+			if collection == "" {
+				collection = registry.Default()
+			}
+			http.Error(w, fmt.Sprintf("Key %q may not access collection %q", id.Name, collection), http.StatusForbidden)
+			return false
+		}
+	}
+	return true
+}
+
+// corsOrigins is the CORS_ORIGINS allow-list; "*" allows any origin.
+var corsOrigins = func() map[string]bool {
+	origins := map[string]bool{}
+	for _, origin := range strings.Split(os.Getenv("CORS_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins[origin] = true
+		}
+	}
+	return origins
+}()
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func signJWT(t *testing.T, secret string, header, claims map[string]interface{}) string {
+	t.Helper()
+	encode := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	unsigned := encode(header) + "." + encode(claims)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyJWT(t *testing.T) {
+	auth := &Authenticator{jwtSecret: []byte("secret"), jwtIssuer: "issuer", jwtAudience: "chisel"}
+	hs256 := map[string]interface{}{"alg": "HS256", "typ": "JWT"}
+	claims := func(changes map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"sub":   "alice",
+			"iss":   "issuer",
+			"aud":   "chisel",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"scope": "read other:scope",
+		}
+		for key, value := range changes {
+			if value == nil {
+				delete(c, key)
+			} else {
+				c[key] = value
+			}
+		}
+		return c
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"valid", signJWT(t, "secret", hs256, claims(nil)), true},
+		{"audience list", signJWT(t, "secret", hs256, claims(map[string]interface{}{"aud": []string{"other", "chisel"}})), true},
+		{"alg none", signJWT(t, "secret", map[string]interface{}{"alg": "none"}, claims(nil)), false},
+		{"alg HS512", signJWT(t, "secret", map[string]interface{}{"alg": "HS512"}, claims(nil)), false},
+		{"wrong secret", signJWT(t, "other", hs256, claims(nil)), false},
+		{"expired", signJWT(t, "secret", hs256, claims(map[string]interface{}{"exp": time.Now().Add(-time.Minute).Unix()})), false},
+		{"no expiry", signJWT(t, "secret", hs256, claims(map[string]interface{}{"exp": nil})), false},
+		{"not yet valid", signJWT(t, "secret", hs256, claims(map[string]interface{}{"nbf": time.Now().Add(time.Hour).Unix()})), false},
+		{"wrong audience", signJWT(t, "secret", hs256, claims(map[string]interface{}{"aud": "other"})), false},
+		{"missing audience", signJWT(t, "secret", hs256, claims(map[string]interface{}{"aud": nil})), false},
+		{"wrong issuer", signJWT(t, "secret", hs256, claims(map[string]interface{}{"iss": "someone"})), false},
+		{"no known scope", signJWT(t, "secret", hs256, claims(map[string]interface{}{"scope": "other:scope"})), false},
+		{"bad tenant", signJWT(t, "secret", hs256, claims(map[string]interface{}{"tenant_id": "../x"})), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			id, err := auth.verifyJWT(test.token)
+			if (err == nil) != test.valid {
+				t.Fatalf("verifyJWT err = %v, want valid %v", err, test.valid)
+			}
+			if test.valid && (id.Name != "alice" || len(id.Scopes) != 1 || id.Scopes[0] != scopeRead) {
+				t.Errorf("identity = %+v, want alice with only the read scope", id)
+			}
+		})
+	}
+}
+
+func TestCanAccess(t *testing.T) {
+	saved := registry
+	t.Cleanup(func() { registry = saved })
+	registry = NewCollectionRegistry(filepath.Join(t.TempDir(), "collections.json"), "team-a-default")
+	registry.aliases = map[string]string{"current": "team-a-v2", "leak": "team-b-v1", "docs": "docs_v2"}
+	registry.aliasesFetch = time.Now()
+
+	id := &Identity{Name: "team-a", Scopes: []string{scopeWrite}, Collections: []string{"team-a-*", "shared", "docs"}}
+	tests := []struct {
+		collection string
+		allowed    bool
+	}{
+		{"team-a-docs", true},
+		{"shared", true},
+		{"", true},         // The default collection matches the pattern
+		{"current", true},  // Alias of an allowed collection
+		{"leak", false},    // Alias of a foreign collection
+		{"docs", true},     // Allowed name that became an alias of a new version
+		{"docs_v2", false}, // The version itself isn't on the list
+		{"team-b-docs", false},
+		{"team-a", false},
+		{"shared-2", false},
+	}
+	for _, test := range tests {
+		if got := id.CanAccess(test.collection); got != test.allowed {
+			t.Errorf("CanAccess(%q) = %v, want %v", test.collection, got, test.allowed)
+		}
+	}
+
+	if !(*Identity)(nil).CanAccess("anything") || !(&Identity{}).CanAccess("anything") {
+		t.Error("no identity or an empty allow-list must allow every collection")
+	}
+}
+
+func TestHasScope(t *testing.T) {
+	write := &Identity{Scopes: []string{scopeWrite}}
+	if !write.HasScope(scopeRead) || !write.HasScope(scopeWrite) || write.HasScope(scopeAdmin) {
+		t.Errorf("write scope grants read and write only")
+	}
+	if !(*Identity)(nil).HasScope(scopeAdmin) {
+		t.Errorf("a nil identity allows everything")
+	}
+}
@@ -4,38 +4,98 @@ import (
 	"log"
 	"strings"
 	"time"
+	"unicode"
+
+	"github.com/google/uuid"
 )
 
-func SentenceChunk(text, origin string) []Chunk {
+// Sentence-final punctuation across scripts: Latin, CJK full and half width,
+// Devanagari danda, Arabic and Urdu, Armenian, Ethiopic, Myanmar, Khmer, Georgian.
+var sentenceTerminators = map[rune]bool{
+	'.': true, '!': true, '?': true, '‼': true, '⁇': true, '⁈': true, '⁉': true,
+	'。': true, '！': true, '？': true, '．': true, '｡': true, '︒': true, '﹒': true, '﹖': true, '﹗': true,
+	'।': true, '॥': true, '؟': true, '۔': true, '։': true, '።': true, '፧': true, '፨': true,
+	'။': true, '។': true, '៕': true, '჻': true,
+}
+
+// isSentenceCloser reports quotes and brackets that close a sentence, like 」 or ".
+func isSentenceCloser(r rune) bool {
+	return r == '"' || r == '\'' || unicode.In(r, unicode.Pe, unicode.Pf)
+}
+
+// Headroom below the embedder's limit for the words borrowed from neighbouring chunks.
+const chunkOverlapTokens = 32
+
+// SentenceChunk splits text into sentences and groups consecutive ones into chunks
+// of up to opts.TargetTokens, counted with the embedding model's tokenizer.
+// Sentences longer than the model accepts are cut into several chunks.
+func SentenceChunk(text, origin string, opts ChunkOptions) []Chunk {
 	var chunks []Chunk
 	var sentence strings.Builder
 	var sentences []string
+	var spans [][2]int // First and last source line of each sentence
 	runes := []rune(text)
 
-	// Basic sentence split
-	for _, r := range runes {
+	line, startLine := 1, 0
+	flush := func() {
+		trimmed := strings.TrimSpace(sentence.String())
+		if trimmed != "" {
+			sentences = append(sentences, trimmed)
+			spans = append(spans, [2]int{startLine, line})
+		}
+		sentence.Reset()
+		startLine = 0
+	}
+
+	// Sentence split on the terminators of any script
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if startLine == 0 && !unicode.IsSpace(r) {
+			startLine = line
+		}
 		sentence.WriteRune(r)
-		if r == '.' || r == '!' || r == '?' {
-			trimmed := strings.TrimSpace(sentence.String())
-			if trimmed != "" {
-				sentences = append(sentences, trimmed)
-			}
-			sentence.Reset()
+		if r == '\n' {
+			line++
+		}
+		if !sentenceTerminators[r] {
+			continue
+		}
+
+		// Runs like "?!" and closing quotes or brackets stay with the sentence.
+		for i+1 < len(runes) && (sentenceTerminators[runes[i+1]] || isSentenceCloser(runes[i+1])) {
+			i++
+			sentence.WriteRune(runes[i])
+		}
+		// A full stop only ends a sentence before whitespace, so "3.14" and "example.com" stay whole.
+		if r == '.' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) {
+			continue
+		}
+		flush()
+	}
+	flush()
+
+	piiFound := make([][]string, len(sentences))
+	if opts.Redaction.Mode != "" {
+		var dropped int
+		sentences, spans, piiFound, dropped = redactSentences(sentences, spans, opts.Redaction)
+		if dropped > 0 {
+			log.Printf("Dropped %d sentences containing PII", dropped)
 		}
 	}
 
+	sentences, spans, piiFound = groupSentences(sentences, spans, piiFound, opts)
+
+	// Short chunks often hold too few words to tell; they inherit the document's language.
+	documentLanguage := DetectLanguage(text)
+
 	// Build chunks with overlap
+	documentID := uuid.New().String()
 	for i, current := range sentences {
 		chunkParts := []string{}
 
 		// Add 3 trailing words from previous sentence
 		if i > 0 {
-			prevWords := strings.Fields(sentences[i-1])
-			start := len(prevWords) - 3
-			if start < 0 {
-				start = 0
-			}
-			chunkParts = append(chunkParts, strings.Join(prevWords[start:], " "))
+			chunkParts = append(chunkParts, overlapWords(sentences[i-1], false))
 		}
 
 		// Add current sentence
@@ -43,32 +103,123 @@ func SentenceChunk(text, origin string) []Chunk {
 
 		// Add 3 leading words from next sentence
 		if i+1 < len(sentences) {
-			nextWords := strings.Fields(sentences[i+1])
-			end := 3
-			if len(nextWords) < end {
-				end = len(nextWords)
-			}
-			chunkParts = append(chunkParts, strings.Join(nextWords[:end], " "))
+			chunkParts = append(chunkParts, overlapWords(sentences[i+1], true))
 		}
 
-		log.Print("starting embedding")
-		text := strings.Join(chunkParts, " ")
-		embedding, err := GetEmbedding(text)
-		if err != nil {
-			log.Printf("embedding error: %v", err)
-			embedding = []float32{}
+		language := DetectLanguage(current)
+		// Kanji-only sentences of a Japanese text look Chinese on their own.
+		if language == undeterminedLanguage || (language == "zh" && documentLanguage == "ja") {
+			language = documentLanguage
+		}
+
+		metadata := map[string]interface{}{"language": language}
+		if len(piiFound[i]) > 0 {
+			metadata["pii_types"] = piiFound[i]
 		}
 
+		text := strings.Join(chunkParts, " ")
 		chunks = append(chunks, Chunk{
 			Text:       text,
 			Origin:     origin,
 			LineNumber: i + 1,
+			LineStart:  spans[i][0],
+			LineEnd:    spans[i][1],
+			ChunkIndex: i,
+			DocumentID: documentID,
+			Sentence:   current,
 			Timestamp:  time.Now(),
 			Tags:       []string{},
-			Metadata:   map[string]interface{}{},
-			Vector:     embedding,
+			Metadata:   metadata,
 		})
 	}
 
 	return chunks
 }
+
+// groupSentences splits oversized sentences at token boundaries, then joins
+// neighbours while they fit in the target size. Spans and PII types are merged to match.
+func groupSentences(sentences []string, spans [][2]int, pii [][]string, opts ChunkOptions) ([]string, [][2]int, [][]string) {
+	maxTokens := EmbeddingMaxTokens(opts.Model) - chunkOverlapTokens
+
+	var units []string
+	var unitSpans [][2]int
+	var unitPII [][]string
+	var unitTokens []int
+	for i, sentence := range sentences {
+		tokens := CountTokens(opts.Model, sentence)
+		if tokens <= maxTokens {
+			units = append(units, sentence)
+			unitSpans = append(unitSpans, spans[i])
+			unitPII = append(unitPII, pii[i])
+			unitTokens = append(unitTokens, tokens)
+			continue
+		}
+		for _, piece := range SplitTokens(opts.Model, sentence, maxTokens) {
+			if piece = strings.TrimSpace(piece); piece != "" {
+				units = append(units, piece)
+				unitSpans = append(unitSpans, spans[i])
+				unitPII = append(unitPII, pii[i])
+				unitTokens = append(unitTokens, CountTokens(opts.Model, piece))
+			}
+		}
+	}
+
+	target := opts.TargetTokens
+	if target <= 0 {
+		return units, unitSpans, unitPII
+	}
+	if target > maxTokens {
+		target = maxTokens
+	}
+
+	var grouped []string
+	var groupedSpans [][2]int
+	var groupedPII [][]string
+	var group []string
+	var groupSpan [2]int
+	var groupPII []string
+	groupTokens := 0
+	for i, unit := range units {
+		// Joining adds about a token per space.
+		if len(group) > 0 && groupTokens+1+unitTokens[i] > target {
+			grouped = append(grouped, strings.Join(group, " "))
+			groupedSpans = append(groupedSpans, groupSpan)
+			groupedPII = append(groupedPII, groupPII)
+			group, groupPII, groupTokens = nil, nil, 0
+		}
+		if len(group) == 0 {
+			groupSpan = unitSpans[i]
+		} else {
+			groupTokens++
+		}
+		group = append(group, unit)
+		groupSpan[1] = unitSpans[i][1]
+		groupPII = mergePIITypes(groupPII, unitPII[i])
+		groupTokens += unitTokens[i]
+	}
+	if len(group) > 0 {
+		grouped = append(grouped, strings.Join(group, " "))
+		groupedSpans = append(groupedSpans, groupSpan)
+		groupedPII = append(groupedPII, groupPII)
+	}
+	return grouped, groupedSpans, groupedPII
+}
+
+// overlapWords returns the first (leading) or last three words of a sentence.
+// Scripts written without spaces, like Chinese or Japanese, get a few characters instead.
+func overlapWords(sentence string, leading bool) string {
+	words := strings.Fields(sentence)
+	if len(words) == 1 {
+		if runes := []rune(words[0]); len(runes) > 12 {
+			if leading {
+				return string(runes[:6])
+			}
+			return string(runes[len(runes)-6:])
+		}
+	}
+
+	if leading {
+		return strings.Join(words[:min(3, len(words))], " ")
+	}
+	return strings.Join(words[max(0, len(words)-3):], " ")
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+type CollectionStats struct {
+	Name           string   `json:"name"`
+	PointsCount    int      `json:"points_count"`
+	EmbeddingModel string   `json:"embedding_model"`
+	Dimension      int      `json:"dimension"`
+	Origins        []string `json:"origins"`
+	OldestChunk    string   `json:"oldest_timestamp,omitempty"`
+	NewestChunk    string   `json:"newest_timestamp,omitempty"`
+}
+
+// CollectCollectionStats scrolls a collection's origins and timestamps to summarise what it holds.
+func CollectCollectionStats(ctx context.Context, name string) (CollectionStats, error) {
+	info, err := registry.Get(ctx, name)
+	if err != nil {
+		return CollectionStats{}, err
+	}
+
+	stats := CollectionStats{
+		Name:           name,
+		EmbeddingModel: info.EmbeddingModel,
+		Dimension:      info.Dimension,
+		Origins:        []string{},
+	}
+
+	origins := map[string]bool{}
+	var oldest, newest time.Time
+	err = ScrollQdrant(ctx, name, nil, []string{"origin", "timestamp"}, false, func(points []SearchHit) error {
+		for _, point := range points {
+			stats.PointsCount++
+			origins[hitOrigin(point)] = true
+
+			timestamp, err := time.Parse(time.RFC3339, payloadString(point.Payload, "timestamp"))
+			if err != nil {
+				continue
+			}
+			if oldest.IsZero() || timestamp.Before(oldest) {
+				oldest = timestamp
+			}
+			if newest.IsZero() || timestamp.After(newest) {
+				newest = timestamp
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return CollectionStats{}, err
+	}
+
+	for origin := range origins {
+		stats.Origins = append(stats.Origins, origin)
+	}
+	sort.Strings(stats.Origins)
+
+	if !oldest.IsZero() {
+		stats.OldestChunk = oldest.Format(time.RFC3339)
+		stats.NewestChunk = newest.Format(time.RFC3339)
+	}
+
+	return stats, nil
+}
+
+func listCollectionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	names, err := ListQdrantCollections(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list collections: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	id := IdentityFrom(r.Context())
+	collections := []CollectionInfo{}
+	for _, name := range names {
+		if !id.CanAccess(name) {
+			continue
+		}
+		info, err := registry.Get(r.Context(), name)
+		if err != nil {
+			log.Printf("Error reading collection %s: %v", name, err)
+			info = CollectionInfo{Name: name}
+		}
+		collections = append(collections, info)
+	}
+
+	defaultName := registry.Default()
+	if !id.CanAccess(defaultName) {
+		defaultName = ""
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"default":     defaultName,
+		"collections": collections,
+	})
+}
+
+func getCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.PathValue("name")
+	if !authorizeCollections(w, r, name) {
+		return
+	}
+	details, err := GetQdrantCollectionInfo(r.Context(), name)
+	if errors.Is(err, ErrCollectionNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch collection: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	info, err := registry.Get(r.Context(), name)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch collection: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Qdrant counts every tenant's points; a tenant only gets its own.
+	pointsCount := details["points_count"]
+	if TenantFrom(r.Context()) != "" {
+		if pointsCount, err = CountQdrantPoints(r.Context(), name, nil); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to count points: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	var vectorConfig interface{}
+	if config, ok := details["config"].(map[string]interface{}); ok {
+		if params, ok := config["params"].(map[string]interface{}); ok {
+			vectorConfig = params["vectors"]
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"name":            name,
+		"status":          details["status"],
+		"points_count":    pointsCount,
+		"embedding_model": info.EmbeddingModel,
+		"dimension":       info.Dimension,
+		"created_at":      info.CreatedAt,
+		"vectors":         vectorConfig,
+		"config":          details["config"],
+	})
+}
+
+func collectionStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.PathValue("name")
+	if !authorizeCollections(w, r, name) {
+		return
+	}
+
+	stats, err := CollectCollectionStats(r.Context(), name)
+	if errors.Is(err, ErrCollectionNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to collect stats: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+func createIndexHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var payload struct {
+		Field       string `json:"field,omitempty"`        // Payload path, e.g. "origin"
+		MetadataKey string `json:"metadata_key,omitempty"` // Shorthand for "metadata.<key>"
+		Schema      string `json:"schema,omitempty"`       // Defaults to keyword
+		Standard    bool   `json:"standard,omitempty"`     // (Re)create the standard indexes
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	name := r.PathValue("name")
+	if !authorizeCollections(w, r, name) {
+		return
+	}
+	field := payload.Field
+	if payload.MetadataKey != "" {
+		field = "metadata." + payload.MetadataKey
+	}
+	if field == "" && !payload.Standard {
+		http.Error(w, "Missing 'field', 'metadata_key' or 'standard'", http.StatusBadRequest)
+		return
+	}
+
+	schema := payload.Schema
+	if schema == "" {
+		schema = "keyword"
+	}
+	if !validIndexSchemas[schema] {
+		http.Error(w, fmt.Sprintf("Unsupported index schema %q", schema), http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	if payload.Standard {
+		err = CreateStandardIndexes(r.Context(), name)
+	}
+	if err == nil && field != "" {
+		err = CreatePayloadIndex(r.Context(), name, field, schema)
+	}
+	if errors.Is(err, ErrCollectionNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to create index: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "indexed",
+		"field":  field,
+		"schema": schema,
+	})
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math/bits"
+	"strings"
+	"unicode"
+)
+
+const (
+	defaultDedupThreshold = 0.95 // Cosine similarity at which a point counts as a duplicate
+	simHashMaxDistance    = 3    // Differing bits out of 64 for two texts to count as the same
+	simHashShingle        = 3    // Words per feature
+)
+
+// DedupOptions configures the optional duplicate check of /chunk.
+type DedupOptions struct {
+	Mode      string  // "" (off), "skip" or "merge"
+	Threshold float64 // Similarity to an existing point, 0 uses defaultDedupThreshold
+}
+
+// DedupResult counts what the duplicate check did.
+type DedupResult struct {
+	InBatch int // Repeats of an earlier chunk in the same text
+	Skipped int // Already in the collection, dropped
+	Merged  int // Already in the collection, origin added to the existing point
+}
+
+func (o DedupOptions) Validate() error {
+	switch o.Mode {
+	case "", "skip", "merge":
+	default:
+		return fmt.Errorf("unknown dedup mode %q, expected skip or merge", o.Mode)
+	}
+	if o.Threshold < 0 || o.Threshold > 1 {
+		return fmt.Errorf("dedup_threshold must be between 0 and 1")
+	}
+	return nil
+}
+
+// DedupChunks drops chunks that repeat an earlier chunk of the batch (by SimHash)
+// or a point already in the collection (by vector similarity). In merge mode the
+// chunk's origin is appended to the existing point's "origins" payload instead.
+// Chunks must already be embedded.
+func DedupChunks(ctx context.Context, chunks []Chunk, collection string, opts DedupOptions) ([]Chunk, DedupResult, error) {
+	var result DedupResult
+	if opts.Mode == "" {
+		return chunks, result, nil
+	}
+	threshold := opts.Threshold
+	if threshold == 0 {
+		threshold = defaultDedupThreshold
+	}
+
+	// Similarity scores are only comparable to a threshold for angular distances.
+	checkCollection := true
+	if info, err := registry.Get(ctx, collection); err == nil && info.Distance != "" && info.Distance != "Cosine" && info.Distance != "Dot" {
+		log.Printf("Skipping duplicate search in %s: scores with %s distance have no fixed scale", collection, info.Distance)
+		checkCollection = false
+	}
+
+	kept := []Chunk{}
+	var keptHashes []uint64
+	for _, chunk := range chunks {
+		hash := SimHash(chunk.Text)
+		if containsNearHash(keptHashes, hash) {
+			result.InBatch++
+			continue
+		}
+
+		if checkCollection && len(chunk.Vector) > 0 {
+			hits, err := SearchQdrant(ctx, collection, chunk.Vector, nil, 1, false)
+			if err != nil {
+				return nil, result, fmt.Errorf("duplicate search failed: %w", err)
+			}
+			if len(hits) > 0 && hits[0].Score >= threshold {
+				if opts.Mode == "merge" {
+					if err := mergeOrigin(ctx, collection, hits[0], chunk.Origin); err != nil {
+						return nil, result, err
+					}
+					result.Merged++
+				} else {
+					result.Skipped++
+				}
+				continue
+			}
+		}
+
+		kept = append(kept, chunk)
+		keptHashes = append(keptHashes, hash)
+	}
+
+	return kept, result, nil
+}
+
+// mergeOrigin records origin on an existing point, keeping its original origin first.
+func mergeOrigin(ctx context.Context, collection string, hit SearchHit, origin string) error {
+	origins := payloadStrings(hit.Payload, "origins")
+	if len(origins) == 0 {
+		if existing := payloadString(hit.Payload, "origin"); existing != "" {
+			origins = []string{existing}
+		}
+	}
+	for _, known := range origins {
+		if known == origin {
+			return nil
+		}
+	}
+	origins = append(origins, origin)
+
+	if err := SetQdrantPayload(ctx, collection, hit.ID, map[string]interface{}{"origins": origins}); err != nil {
+		return fmt.Errorf("failed to merge origin into point %v: %w", hit.ID, err)
+	}
+	return nil
+}
+
+func payloadStrings(payload map[string]interface{}, key string) []string {
+	values, _ := payload[key].([]interface{})
+	var result []string
+	for _, value := range values {
+		if s, ok := value.(string); ok {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+func containsNearHash(hashes []uint64, hash uint64) bool {
+	for _, other := range hashes {
+		if bits.OnesCount64(hash^other) <= simHashMaxDistance {
+			return true
+		}
+	}
+	return false
+}
+
+// SimHash fingerprints text from its word shingles, so texts differing in a few
+// words or in punctuation and case get fingerprints a few bits apart.
+func SimHash(text string) uint64 {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(words) == 0 {
+		return 0
+	}
+
+	var weights [64]int
+	addFeature := func(feature string) {
+		hasher := fnv.New64a()
+		hasher.Write([]byte(feature))
+		sum := hasher.Sum64()
+		for bit := 0; bit < 64; bit++ {
+			if sum&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+
+	if len(words) < simHashShingle {
+		addFeature(strings.Join(words, " "))
+	}
+	for i := 0; i+simHashShingle <= len(words); i++ {
+		addFeature(strings.Join(words[i:i+simHashShingle], " "))
+	}
+
+	var hash uint64
+	for bit, weight := range weights {
+		if weight > 0 {
+			hash |= 1 << bit
+		}
+	}
+	return hash
+}
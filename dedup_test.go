@@ -0,0 +1,51 @@
+package main
+
+import (
+	"math/bits"
+	"testing"
+)
+
+func TestSimHash(t *testing.T) {
+	base := "The quarterly report shows revenue grew by twelve percent while operating costs stayed flat across all regions"
+	tests := []struct {
+		name  string
+		other string
+		near  bool
+	}{
+		{"identical", base, true},
+		{"case and punctuation", "the QUARTERLY report shows revenue grew by twelve percent, while operating costs stayed flat across all regions!", true},
+		{"extra whitespace", "The  quarterly report shows revenue grew by twelve percent\nwhile operating costs stayed flat across all regions", true},
+		{"different text", "Our new onboarding guide explains how to request laptop access and set up two factor authentication", false},
+		{"same topic, other wording", "Revenue for the quarter rose twelve percent and costs did not change in any region according to the report", false},
+	}
+	hash := SimHash(base)
+	for _, test := range tests {
+		other := SimHash(test.other)
+		if got := containsNearHash([]uint64{other}, hash); got != test.near {
+			t.Errorf("%s: near = %v (%d bits apart), want %v", test.name, got, bits.OnesCount64(hash^other), test.near)
+		}
+	}
+
+	if SimHash("") != 0 || SimHash("?!") != 0 {
+		t.Error("text without words must hash to 0")
+	}
+}
+
+func TestContainsNearHash(t *testing.T) {
+	hash := uint64(0b1011_0000)
+	tests := []struct {
+		hashes []uint64
+		want   bool
+	}{
+		{nil, false},
+		{[]uint64{hash}, true},
+		{[]uint64{hash ^ 0b111}, true},   // simHashMaxDistance bits apart
+		{[]uint64{hash ^ 0b1111}, false}, // One bit more
+		{[]uint64{^hash, hash ^ 1}, true},
+	}
+	for _, test := range tests {
+		if got := containsNearHash(test.hashes, hash); got != test.want {
+			t.Errorf("containsNearHash(%b) = %v, want %v", test.hashes, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const defaultEmbeddingCacheSize = 10000 // Entries kept in memory
+
+// EmbeddingCache maps model + sha256(text) to a vector. Because the model is part
+// of the key, switching models never serves a stale vector; old entries simply
+// age out of the LRU. With a directory set, vectors are also written to disk so
+// they survive restarts.
+type EmbeddingCache struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List // Front is most recently used
+	dir      string     // Empty disables the disk tier
+
+	hits     atomic.Int64
+	diskHits atomic.Int64
+	misses   atomic.Int64
+}
+
+type embeddingCacheEntry struct {
+	key    string
+	vector []float32
+}
+
+// CacheStats reports how well a cache is doing.
+type CacheStats struct {
+	Entries  int     `json:"entries"`
+	Capacity int     `json:"capacity"`
+	Hits     int64   `json:"hits"`
+	DiskHits int64   `json:"disk_hits"`
+	Misses   int64   `json:"misses"`
+	HitRate  float64 `json:"hit_rate"`
+	Disk     bool    `json:"disk"`
+}
+
+// embeddingCache is configured with EMBEDDING_CACHE_SIZE and EMBEDDING_CACHE_DIR.
+var embeddingCache = NewEmbeddingCache(envInt("EMBEDDING_CACHE_SIZE", defaultEmbeddingCacheSize), os.Getenv("EMBEDDING_CACHE_DIR"))
+
+func NewEmbeddingCache(capacity int, dir string) *EmbeddingCache {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			log.Printf("Error creating embedding cache directory, disk tier disabled: %v", err)
+			dir = ""
+		}
+	}
+	return &EmbeddingCache{
+		capacity: capacity,
+		entries:  map[string]*list.Element{},
+		order:    list.New(),
+		dir:      dir,
+	}
+}
+
+func embeddingCacheKey(model, text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return model + ":" + hex.EncodeToString(sum[:])
+}
+
+// Get returns the cached vector for text under model, checking memory then disk.
+func (c *EmbeddingCache) Get(model, text string) ([]float32, bool) {
+	key := embeddingCacheKey(model, text)
+
+	c.mu.Lock()
+	if element, ok := c.entries[key]; ok {
+		c.order.MoveToFront(element)
+		vector := element.Value.(*embeddingCacheEntry).vector
+		c.mu.Unlock()
+		c.hits.Add(1)
+		return vector, true
+	}
+	c.mu.Unlock()
+
+	if vector, ok := c.readDisk(key); ok {
+		c.remember(key, vector)
+		c.hits.Add(1)
+		c.diskHits.Add(1)
+		return vector, true
+	}
+
+	c.misses.Add(1)
+	return nil, false
+}
+
+// Put stores a vector in memory and, when enabled, on disk.
+func (c *EmbeddingCache) Put(model, text string, vector []float32) {
+	key := embeddingCacheKey(model, text)
+	c.remember(key, vector)
+	if err := c.writeDisk(key, vector); err != nil {
+		log.Printf("Error writing embedding cache entry: %v", err)
+	}
+}
+
+func (c *EmbeddingCache) remember(key string, vector []float32) {
+	if c.capacity <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*embeddingCacheEntry).vector = vector
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&embeddingCacheEntry{key: key, vector: vector})
+
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*embeddingCacheEntry).key)
+	}
+}
+
+// diskPath spreads entries over one directory per model and hash prefix.
+func (c *EmbeddingCache) diskPath(key string) string {
+	model, hash, _ := strings.Cut(key, ":")
+	return filepath.Join(c.dir, safePathComponent(model), hash[:2], hash)
+}
+
+// Vectors are stored as little-endian float32s.
+func (c *EmbeddingCache) readDisk(key string) ([]float32, bool) {
+	if c.dir == "" {
+		return nil, false
+	}
+	data, err := os.ReadFile(c.diskPath(key))
+	if err != nil || len(data) == 0 || len(data)%4 != 0 {
+		return nil, false
+	}
+	vector := make([]float32, len(data)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:]))
+	}
+	return vector, true
+}
+
+func (c *EmbeddingCache) writeDisk(key string, vector []float32) error {
+	if c.dir == "" {
+		return nil
+	}
+	path := c.diskPath(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	data := make([]byte, len(vector)*4)
+	for i, value := range vector {
+		binary.LittleEndian.PutUint32(data[i*4:], math.Float32bits(value))
+	}
+
+	// Write then rename so a concurrent reader never sees a partial vector.
+	tmp, err := os.CreateTemp(filepath.Dir(path), "tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (c *EmbeddingCache) Stats() CacheStats {
+	c.mu.Lock()
+	entries := c.order.Len()
+	c.mu.Unlock()
+
+	stats := CacheStats{
+		Entries:  entries,
+		Capacity: c.capacity,
+		Hits:     c.hits.Load(),
+		DiskHits: c.diskHits.Load(),
+		Misses:   c.misses.Load(),
+		Disk:     c.dir != "",
+	}
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(total)
+	}
+	return stats
+}
+
+// safePathComponent keeps model names usable as directory names.
+func safePathComponent(name string) string {
+	if name == "" || name == "." || name == ".." {
+		return "_"
+	}
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+func envInt(name string, fallback int) int {
+	if value, err := strconv.Atoi(os.Getenv(name)); err == nil {
+		return value
+	}
+	return fallback
+}
@@ -2,49 +2,135 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"os"
+	"time"
 )
 
-func GetEmbedding(text string) ([]float32, error) {
+const openaiEmbeddingURL = "https://api.openai.com/v1/embeddings"
+const openaiEmbeddingModel = "text-embedding-3-small"
+
+// Embedding calls have no side effects, so they are always safe to resend.
+var embeddingPolicy = RetryPolicy{Timeout: 30 * time.Second, Idempotent: true}
+
+// Input limit shared by OpenAI's embedding models.
+const embeddingMaxTokens = 8191
+
+// Output dimension of each supported embedding model.
+var embeddingDimensions = map[string]int{
+	"text-embedding-3-small": 1536,
+	"text-embedding-3-large": 3072,
+	"text-embedding-ada-002": 1536,
+}
+
+// DefaultEmbeddingModel returns the model used for new collections, set via EMBEDDING_MODEL.
+func DefaultEmbeddingModel() string {
+	if model := os.Getenv("EMBEDDING_MODEL"); model != "" {
+		return model
+	}
+	return openaiEmbeddingModel
+}
+
+// EmbeddingMaxTokens returns the longest input a model accepts.
+func EmbeddingMaxTokens(model string) int {
+	return embeddingMaxTokens
+}
+
+// EmbeddingDimension returns the vector size of a model, or 0 if it is unknown.
+func EmbeddingDimension(model string) int {
+	return embeddingDimensions[model]
+}
+
+// EmbedChunks fills in the vector of every chunk using the given model.
+// Chunks that fail to embed keep an empty vector and are rejected at upload;
+// only cancellation of ctx aborts the batch.
+func EmbedChunks(ctx context.Context, chunks []Chunk, model string) ([]Chunk, error) {
+	for i := range chunks {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		log.Print("starting embedding")
+		embedding, err := GetEmbedding(ctx, chunks[i].Text, model)
+		if err != nil {
+			log.Printf("embedding error: %v", err)
+			embedding = []float32{}
+		}
+		chunks[i].Vector = embedding
+	}
+	return chunks, nil
+}
+
+// GetEmbedding returns the embedding for a given string, from the cache or the OpenAI API.
+func GetEmbedding(ctx context.Context, text string, model string) ([]float32, error) {
+	if vector, ok := embeddingCache.Get(model, text); ok {
+		return vector, nil
+	}
+
+	// Chunks are sized below the limit; this catches long queries and generated passages.
+	input := text
+	if CountTokens(model, text) > EmbeddingMaxTokens(model) {
+		log.Printf("Truncating %d byte text to the %d token limit of %s", len(text), EmbeddingMaxTokens(model), model)
+		input = TruncateTokens(model, text, EmbeddingMaxTokens(model))
+	}
+
+	vector, err := fetchEmbedding(ctx, input, model)
+	if err != nil {
+		return nil, err
+	}
+	embeddingCache.Put(model, text, vector)
+	return vector, nil
+}
+
+func fetchEmbedding(ctx context.Context, text string, model string) ([]float32, error) {
 	apiKey := os.Getenv("OPENAI_API_KEY")
 	if apiKey == "" {
 		return nil, fmt.Errorf("OPENAI_API_KEY not set")
 	}
 
-	url := "https://api.openai.com/v1/embeddings"
 	body := map[string]interface{}{
-		"model": "text-embedding-3-small",
+		"model": model,
 		"input": text,
 	}
 	jsonBody, _ := json.Marshal(body)
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonBody))
+	res, reservation, err := doRateLimited(ctx, openaiEmbeddingURL, CountTokens(model, text), embeddingPolicy, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", openaiEmbeddingURL, bytes.NewBuffer(jsonBody))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	defer res.Body.Close()
 
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-	req.Header.Set("Content-Type", "application/json")
-
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
+	if res.StatusCode != http.StatusOK {
+		reservation.Cancel()
+		bodyBytes, _ := io.ReadAll(res.Body)
+		return nil, errors.New(string(bodyBytes))
 	}
-	defer res.Body.Close()
 
 	var result struct {
 		Data []struct {
 			Embedding []float32 `json:"embedding"`
 		} `json:"data"`
+		Usage tokenUsage `json:"usage"`
 	}
 
 	err = json.NewDecoder(res.Body).Decode(&result)
 	if err != nil {
 		return nil, err
 	}
+	reservation.Settle(result.Usage.TotalTokens)
 
 	if len(result.Data) == 0 {
 		return nil, fmt.Errorf("no embeddings returned")
@@ -1,20 +1,44 @@
 package main
 
-func EnrichChunksWithTags(chunks []Chunk) ([]Chunk, error) {
+import (
+	"context"
+	"log"
+)
+
+// EnrichChunksWithTags tags the chunks with tagger, switching to fallback if it fails.
+// Identical texts are tagged once. A nil fallback makes tagger errors fatal.
+func EnrichChunksWithTags(ctx context.Context, chunks []Chunk, tagger Tagger, fallback Tagger) ([]Chunk, error) {
 	var texts []string
-	for _, chunk := range chunks {
-		texts = append(texts, chunk.Text)
+	textIndex := map[string]int{}
+	chunkText := make([]int, len(chunks)) // Index into texts for every chunk
+	for i, chunk := range chunks {
+		index, seen := textIndex[chunk.Text]
+		if !seen {
+			index = len(texts)
+			textIndex[chunk.Text] = index
+			texts = append(texts, chunk.Text)
+		}
+		chunkText[i] = index
+	}
+	if len(texts) < len(chunks) {
+		log.Printf("Tagging %d unique texts for %d chunks", len(texts), len(chunks))
 	}
 
-	allTags, err := BatchGenerateTags(texts)
+	allTags, err := tagger.Tag(ctx, texts)
+	if err != nil && fallback != nil && ctx.Err() == nil {
+		log.Printf("Tagger %s failed, falling back to %s: %v", tagger.Name(), fallback.Name(), err)
+		tagger = fallback
+		allTags, err = tagger.Tag(ctx, texts)
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	for i := range chunks {
-		if i < len(allTags) {
-			chunks[i].Tags = append(chunks[i].Tags, allTags[i]...)
-			chunks[i].Metadata["auto_tags"] = allTags[i]
+		if index := chunkText[i]; index < len(allTags) {
+			chunks[i].Tags = append(chunks[i].Tags, allTags[index]...)
+			chunks[i].Metadata["auto_tags"] = allTags[index]
+			chunks[i].Metadata["tagger"] = tagger.Name()
 		}
 	}
 
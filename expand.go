@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const maxExpand = 10
+
+// ExpandHits attaches a passage made of the n chunks before and after each hit.
+// Neighbours are found by chunk_index within the same document (or origin for
+// points stored before documents were tracked). Hits that already sit inside
+// the passage of a better-scoring hit are dropped.
+func ExpandHits(ctx context.Context, hits []SearchHit, n int) ([]SearchHit, error) {
+	if n <= 0 {
+		return hits, nil
+	}
+
+	covered := map[string]map[int]bool{}
+	var result []SearchHit
+
+	for _, hit := range hits {
+		index, ok := payloadInt(hit.Payload, "chunk_index")
+		if !ok {
+			// Nothing to anchor the window on, the hit is its own passage.
+			hit.Passage = &Passage{
+				Text:     payloadString(hit.Payload, "text"),
+				PointIDs: []interface{}{hit.ID},
+			}
+			result = append(result, hit)
+			continue
+		}
+
+		key, docFilter := documentKey(hit)
+		key = hit.Collection + "/" + key
+		if covered[key][index] {
+			continue
+		}
+
+		neighbours, err := fetchChunkRange(ctx, hit.Collection, docFilter, index-n, index+n)
+		if err != nil {
+			return nil, err
+		}
+
+		hit.Passage = mergePassage(neighbours)
+		if hit.Passage == nil {
+			lineStart, _ := payloadInt(hit.Payload, "line_start")
+			lineEnd, _ := payloadInt(hit.Payload, "line_end")
+			hit.Passage = &Passage{
+				Text:       payloadString(hit.Payload, "text"),
+				StartIndex: index,
+				EndIndex:   index,
+				LineStart:  lineStart,
+				LineEnd:    lineEnd,
+				PointIDs:   []interface{}{hit.ID},
+			}
+		}
+
+		if covered[key] == nil {
+			covered[key] = map[int]bool{}
+		}
+		for i := hit.Passage.StartIndex; i <= hit.Passage.EndIndex; i++ {
+			covered[key][i] = true
+		}
+
+		result = append(result, hit)
+	}
+
+	return result, nil
+}
+
+// documentKey identifies the document a hit belongs to, along with the filter condition matching it.
+func documentKey(hit SearchHit) (string, map[string]interface{}) {
+	if documentID := payloadString(hit.Payload, "document_id"); documentID != "" {
+		return "doc:" + documentID, map[string]interface{}{
+			"key":   "document_id",
+			"match": map[string]string{"value": documentID},
+		}
+	}
+
+	origin := hitOrigin(hit)
+	return "origin:" + origin, map[string]interface{}{
+		"key":   "origin",
+		"match": map[string]string{"value": origin},
+	}
+}
+
+func fetchChunkRange(ctx context.Context, collection string, docFilter map[string]interface{}, from, to int) ([]SearchHit, error) {
+	if from < 0 {
+		from = 0
+	}
+
+	filter := map[string]interface{}{
+		"must": []map[string]interface{}{
+			docFilter,
+			{
+				"key":   "chunk_index",
+				"range": map[string]int{"gte": from, "lte": to},
+			},
+		},
+	}
+
+	var points []SearchHit
+	err := ScrollQdrant(ctx, collection, filter, nil, false, func(page []SearchHit) error {
+		points = append(points, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch neighbouring chunks: %w", err)
+	}
+
+	return points, nil
+}
+
+// mergePassage orders chunks by index and joins their sentences, keeping one chunk per index.
+func mergePassage(points []SearchHit) *Passage {
+	byIndex := map[int]SearchHit{}
+	var indexes []int
+	for _, point := range points {
+		index, ok := payloadInt(point.Payload, "chunk_index")
+		if !ok {
+			continue
+		}
+		if _, seen := byIndex[index]; seen {
+			continue
+		}
+		byIndex[index] = point
+		indexes = append(indexes, index)
+	}
+
+	if len(indexes) == 0 {
+		return nil
+	}
+	sort.Ints(indexes)
+
+	var parts []string
+	var ids []interface{}
+	lineStart, _ := payloadInt(byIndex[indexes[0]].Payload, "line_start")
+	lineEnd, _ := payloadInt(byIndex[indexes[len(indexes)-1]].Payload, "line_end")
+	for _, index := range indexes {
+		point := byIndex[index]
+		sentence := payloadString(point.Payload, "sentence")
+		if sentence == "" {
+			sentence = payloadString(point.Payload, "text")
+		}
+		parts = append(parts, sentence)
+		ids = append(ids, point.ID)
+	}
+
+	return &Passage{
+		Text:       strings.Join(parts, " "),
+		StartIndex: indexes[0],
+		EndIndex:   indexes[len(indexes)-1],
+		LineStart:  lineStart,
+		LineEnd:    lineEnd,
+		PointIDs:   ids,
+	}
+}
+
+func payloadString(payload map[string]interface{}, key string) string {
+	if value, ok := payload[key].(string); ok {
+		return value
+	}
+	return ""
+}
+
+func payloadInt(payload map[string]interface{}, key string) (int, bool) {
+	switch value := payload[key].(type) {
+	case float64:
+		return int(value), true
+	case int:
+		return value, true
+	}
+	return 0, false
+}
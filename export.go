@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+const exportFormat = "chisel-export"
+const exportVersion = 1
+const importBatchSize = 64
+
+// ExportHeader is the first line of an export and describes how the vectors were made.
+type ExportHeader struct {
+	Format         string    `json:"format"`
+	Version        int       `json:"version"`
+	Collection     string    `json:"collection"`
+	EmbeddingModel string    `json:"embedding_model"`
+	Dimension      int       `json:"dimension"`
+	Distance       string    `json:"distance,omitempty"`
+	ExportedAt     time.Time `json:"exported_at"`
+}
+
+// ExportRecord is one point of an export, one JSON object per line.
+type ExportRecord struct {
+	ID      interface{}            `json:"id"`
+	Vector  []float32              `json:"vector,omitempty"`
+	Payload map[string]interface{} `json:"payload"`
+}
+
+type ImportResult struct {
+	Collection string `json:"collection"`
+	Imported   int    `json:"imported"`
+	Skipped    int    `json:"skipped"` // Records without a usable vector or text
+	Reembedded bool   `json:"reembedded"`
+}
+
+func exportCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.PathValue("name")
+	if !authorizeCollections(w, r, name) {
+		return
+	}
+	info, err := registry.Get(r.Context(), name)
+	if errors.Is(err, ErrCollectionNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to fetch collection: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".ndjson"))
+	flusher, _ := w.(http.Flusher)
+
+	encoder := json.NewEncoder(w)
+	encoder.Encode(ExportHeader{
+		Format:         exportFormat,
+		Version:        exportVersion,
+		Collection:     name,
+		EmbeddingModel: info.EmbeddingModel,
+		Dimension:      info.Dimension,
+		Distance:       info.Distance,
+		ExportedAt:     time.Now(),
+	})
+
+	exported := 0
+	err = ScrollQdrant(r.Context(), name, nil, nil, true, func(points []SearchHit) error {
+		for _, point := range points {
+			if err := encoder.Encode(ExportRecord{ID: point.ID, Vector: point.Vector, Payload: point.Payload}); err != nil {
+				return err
+			}
+		}
+		exported += len(points)
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		// Headers are already sent, so all we can do is cut the stream short.
+		log.Printf("Export of %s aborted after %d points: %v", name, exported, err)
+		return
+	}
+
+	log.Printf("Exported %d points from %s", exported, name)
+}
+
+func importCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.PathValue("name")
+	if !authorizeCollections(w, r, name) {
+		return
+	}
+	reembed := r.URL.Query().Get("reembed") == "true"
+	model := r.URL.Query().Get("embedding_model")
+
+	result, err := ImportCollection(r.Context(), name, r.Body, model, reembed)
+	if errors.Is(err, errInvalidImport) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, errForeignPoint) || errors.Is(err, errCreateNeedsAdmin) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Import failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+var errInvalidImport = errors.New("invalid import")
+
+// ImportCollection reads an export stream into a collection, creating it if needed
+// and the caller has the admin scope.
+// With reembed set, stored vectors are ignored and each point's text is embedded again.
+func ImportCollection(ctx context.Context, name string, body io.Reader, model string, reembed bool) (ImportResult, error) {
+	result := ImportResult{Collection: name, Reembedded: reembed}
+
+	decoder := json.NewDecoder(body)
+	decoder.UseNumber()
+
+	var first json.RawMessage
+	if err := decoder.Decode(&first); err != nil {
+		return result, fmt.Errorf("%w: empty or malformed stream: %v", errInvalidImport, err)
+	}
+
+	var header ExportHeader
+	var pending *ExportRecord
+	json.Unmarshal(first, &header)
+	if header.Format != exportFormat {
+		// No header line, the first line is already a record.
+		header = ExportHeader{}
+		var record ExportRecord
+		recordDecoder := json.NewDecoder(bytes.NewReader(first))
+		recordDecoder.UseNumber()
+		if err := recordDecoder.Decode(&record); err != nil {
+			return result, fmt.Errorf("%w: %v", errInvalidImport, err)
+		}
+		pending = &record
+	}
+
+	// An existing collection keeps the model it was embedded with; the export's
+	// model only picks one for a collection the import creates.
+	info, err := registry.Get(ctx, name)
+	exists := err == nil
+	if err != nil && !errors.Is(err, ErrCollectionNotFound) {
+		return result, err
+	}
+	if exists && info.EmbeddingModel != "" {
+		if model != "" && model != info.EmbeddingModel {
+			return result, fmt.Errorf("%w: collection %s is embedded with %s, not %s", errInvalidImport, name, info.EmbeddingModel, model)
+		}
+		model = info.EmbeddingModel
+		if !reembed && header.EmbeddingModel != "" && header.EmbeddingModel != model {
+			return result, fmt.Errorf("%w: export was embedded with %s but collection %s uses %s; import with reembed=true", errInvalidImport, header.EmbeddingModel, name, model)
+		}
+	}
+	if model == "" {
+		model = header.EmbeddingModel
+	}
+	if model == "" {
+		model = DefaultEmbeddingModel()
+	}
+	if EmbeddingDimension(model) == 0 {
+		return result, fmt.Errorf("%w: unknown embedding model %q", errInvalidImport, model)
+	}
+	if !reembed && header.Dimension != 0 && header.Dimension != EmbeddingDimension(model) {
+		return result, fmt.Errorf("%w: export has %d dimensions but %s produces %d; import with reembed=true", errInvalidImport, header.Dimension, model, EmbeddingDimension(model))
+	}
+
+	if !exists {
+		if !IdentityFrom(ctx).HasScope(scopeAdmin) {
+			return result, fmt.Errorf("collection %s does not exist and %w", name, errCreateNeedsAdmin)
+		}
+		info, err = registry.Create(ctx, name, model, CollectionConfig{Distance: header.Distance})
+		if err != nil {
+			return result, err
+		}
+	}
+	if info.Dimension != EmbeddingDimension(model) {
+		return result, fmt.Errorf("%w: collection %s has %d dimensions, %s produces %d", errInvalidImport, name, info.Dimension, model, EmbeddingDimension(model))
+	}
+
+	var batch []map[string]interface{}
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := UpsertQdrantPoints(ctx, name, batch); err != nil {
+			return err
+		}
+		result.Imported += len(batch)
+		batch = nil
+		return nil
+	}
+
+	add := func(record ExportRecord) error {
+		vector := record.Vector
+		if reembed || len(vector) == 0 {
+			text := payloadString(record.Payload, "text")
+			if text == "" {
+				result.Skipped++
+				return nil
+			}
+			embedding, err := GetEmbedding(ctx, text, model)
+			if err != nil {
+				return fmt.Errorf("embedding point %v: %w", record.ID, err)
+			}
+			vector = embedding
+		}
+		if len(vector) != info.Dimension {
+			result.Skipped++
+			return nil
+		}
+
+		batch = append(batch, map[string]interface{}{
+			"id":      record.ID,
+			"vector":  qdrantPointVector(ctx, name, vector),
+			"payload": record.Payload,
+		})
+		if len(batch) >= importBatchSize {
+			return flush()
+		}
+		return nil
+	}
+
+	if pending != nil {
+		if err := add(*pending); err != nil {
+			return result, err
+		}
+	}
+
+	line := 1
+	for {
+		line++
+		var record ExportRecord
+		err := decoder.Decode(&record)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return result, fmt.Errorf("%w: record %d: %v", errInvalidImport, line, err)
+		}
+		if record.ID == nil {
+			result.Skipped++
+			continue
+		}
+		if err := add(record); err != nil {
+			return result, err
+		}
+	}
+
+	if err := flush(); err != nil {
+		return result, err
+	}
+
+	log.Printf("Imported %d points into %s (%d skipped)", result.Imported, name, result.Skipped)
+	return result, nil
+}
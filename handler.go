@@ -1,19 +1,29 @@
 package main
 
 import (
-	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"strings"
 )
 
 func chunkHandler(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Text       string `json:"text"`
-		Origin     string `json:"origin"`
-		Collection string `json:"collection,omitempty"`
+		Text             string   `json:"text"`
+		Origin           string   `json:"origin"`
+		Collection       string   `json:"collection,omitempty"`
+		CreateCollection bool     `json:"create_collection,omitempty"` // Create the collection if it is missing, needs the admin scope
+		Tagger           string   `json:"tagger,omitempty"`            // groq, openai, keyword or none
+		TaggerFallback   string   `json:"tagger_fallback,omitempty"`   // Used when an LLM tagger fails, defaults to keyword
+		Dedup            string   `json:"dedup,omitempty"`             // skip or merge near-duplicate chunks, off when empty
+		DedupThreshold   float64  `json:"dedup_threshold,omitempty"`   // Cosine similarity to an existing point, defaults to 0.95
+		TargetTokens     *int     `json:"target_tokens,omitempty"`     // Chunk size in embedding tokens, defaults to CHUNK_TARGET_TOKENS; 0 is one sentence per chunk
+		TagLanguage      string   `json:"tag_language,omitempty"`      // Language LLM tags are written in, defaults to TAG_LANGUAGE
+		Redact           *string  `json:"redact,omitempty"`            // PII handling: mask, hash, drop or "" for none; defaults to PII_REDACTION
+		RedactTypes      []string `json:"redact_types,omitempty"`      // email, phone, iban, credit_card, api_key; defaults to all
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -21,17 +31,105 @@ func chunkHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	targetTokens := envInt("CHUNK_TARGET_TOKENS", 0)
+	if req.TargetTokens != nil {
+		targetTokens = *req.TargetTokens
+	}
+	if targetTokens < 0 {
+		http.Error(w, "target_tokens must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	redaction := DefaultRedactOptions()
+	if req.Redact != nil {
+		redaction.Mode = *req.Redact
+	}
+	if req.RedactTypes != nil {
+		redaction.Types = req.RedactTypes
+	}
+	if err := redaction.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	dedup := DedupOptions{Mode: req.Dedup, Threshold: req.DedupThreshold}
+	if err := dedup.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tagger, err := TaggerByName(req.Tagger)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var fallback Tagger
+	if llm, isLLM := tagger.(LLMTagger); isLLM {
+		if req.TagLanguage != "" {
+			llm.Language = req.TagLanguage
+			tagger = llm
+		}
+		fallbackName := req.TaggerFallback
+		if fallbackName == "" {
+			fallbackName = "keyword"
+		}
+		if fallback, err = TaggerByName(fallbackName); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if !authorizeCollections(w, r, req.Collection) {
+		return
+	}
 	// Use provided collection or fallback to default.
-	collection := req.Collection
-	if collection == "" {
-		collection = "Database"
+	collection := registry.Resolve(req.Collection)
+
+	ctx := r.Context()
+	canCreate := IdentityFrom(ctx).HasScope(scopeAdmin)
+	info, err := registry.Ensure(ctx, collection, req.CreateCollection && canCreate)
+	if errors.Is(err, ErrCollectionNotFound) && req.CreateCollection && !canCreate {
+		http.Error(w, fmt.Sprintf("Collection %q does not exist and %v", collection, errCreateNeedsAdmin), http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, ErrCollectionNotFound) {
+		http.Error(w, fmt.Sprintf("Collection %q does not exist; create it first or set 'create_collection'", collection), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error resolving collection: %v", err)
+		http.Error(w, fmt.Sprintf("Failed to resolve collection: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	model := info.EmbeddingModel
+	if model == "" {
+		model = DefaultEmbeddingModel()
 	}
 
 	log.Printf("Phase 1 - Chunking for collection: %s", collection)
-	chunks := SentenceChunk(req.Text, req.Origin)
+	// Redaction happens while chunking, before any text leaves the process for embedding, tagging or storage.
+	chunks := SentenceChunk(req.Text, req.Origin, ChunkOptions{Model: model, TargetTokens: targetTokens, Redaction: redaction})
 
-	log.Print("Phase 2 - Tagging chunks")
-	taggedChunks, err := EnrichChunksWithTags(chunks)
+	chunks, err = EmbedChunks(ctx, chunks, model)
+	if err != nil {
+		log.Printf("Chunking aborted: %v", err)
+		return
+	}
+
+	if dedup.Mode != "" {
+		var result DedupResult
+		chunks, result, err = DedupChunks(ctx, chunks, collection, dedup)
+		if err != nil {
+			log.Printf("Error checking for duplicates: %v", err)
+			http.Error(w, "Failed to check for duplicate chunks", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Duplicates: %d within the text, %d skipped, %d merged into existing points", result.InBatch, result.Skipped, result.Merged)
+	}
+
+	log.Printf("Phase 2 - Tagging chunks with %s", tagger.Name())
+	taggedChunks, err := EnrichChunksWithTags(ctx, chunks, tagger, fallback)
 	if err != nil {
 		log.Printf("Error tagging chunks: %v", err)
 		http.Error(w, "Failed to tag chunks", http.StatusInternalServerError)
@@ -41,8 +139,11 @@ func chunkHandler(w http.ResponseWriter, r *http.Request) {
 	log.Print("Phase 3 - Uploading chunks to Qdrant")
 	for _, chunk := range taggedChunks {
 		log.Print("Uploading chunk...")
-		if err := SendChunkToQdrant(chunk, collection); err != nil {
+		if err := SendChunkToQdrant(ctx, chunk, collection); err != nil {
 			log.Printf("Error sending chunk to Qdrant: %v", err)
+			if ctx.Err() != nil {
+				return
+			}
 		}
 	}
 
@@ -50,13 +151,109 @@ func chunkHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(taggedChunks)
 }
 
+// lookupParams holds the search options shared by /lookup and /ask.
+type lookupParams struct {
+	Collection   string                 `json:"collection,omitempty"`
+	Collections  []string               `json:"collections,omitempty"` // Searched together with 'collection'
+	Subject      string                 `json:"subject,omitempty"`
+	Origin       string                 `json:"origin,omitempty"`
+	Tags         []string               `json:"tags,omitempty"`     // Match any of these tags
+	Metadata     map[string]interface{} `json:"metadata,omitempty"` // Exact match per metadata key
+	Language     string                 `json:"language,omitempty"` // ISO 639-1 code detected at ingest, e.g. "ja"
+	From         string                 `json:"from,omitempty"`     // ISO8601 timestamp
+	To           string                 `json:"to,omitempty"`
+	Limit        int                    `json:"limit,omitempty"`
+	MMR          bool                   `json:"mmr,omitempty"`
+	Lambda       *float64               `json:"lambda,omitempty"` // 0..1, defaults to 0.7
+	MaxPerOrigin int                    `json:"max_per_origin,omitempty"`
+	Expand       int                    `json:"expand,omitempty"`    // Neighbouring chunks per side
+	Expansion    string                 `json:"expansion,omitempty"` // "multi" or "hyde"
+	NumQueries   int                    `json:"num_queries,omitempty"`
+}
+
+// requested lists the collection names as given, "" for the default when none are.
+func (p lookupParams) requested() []string {
+	var names []string
+	for _, name := range append([]string{p.Collection}, p.Collections...) {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		names = []string{""}
+	}
+	return names
+}
+
+// resolve validates the params and turns them into collections, a filter and lookup options.
+func (p lookupParams) resolve() ([]string, map[string]interface{}, LookupOptions, error) {
+	var collections []string
+	seen := map[string]bool{}
+	for _, name := range p.requested() {
+		name = registry.Resolve(name)
+		if !seen[name] {
+			seen[name] = true
+			collections = append(collections, name)
+		}
+	}
+
+	opts := LookupOptions{
+		Limit:        p.Limit,
+		MMR:          p.MMR,
+		Lambda:       defaultMMRLambda,
+		MaxPerOrigin: p.MaxPerOrigin,
+		Expand:       p.Expand,
+		Expansion:    p.Expansion,
+		NumQueries:   p.NumQueries,
+	}
+	if p.Expansion != "" && p.Expansion != "multi" && p.Expansion != "hyde" {
+		return nil, nil, opts, fmt.Errorf("'expansion' must be \"multi\" or \"hyde\"")
+	}
+	if p.NumQueries < 0 || p.NumQueries > maxExpansionQueries {
+		return nil, nil, opts, fmt.Errorf("'num_queries' must be between 0 and %d", maxExpansionQueries)
+	}
+	if p.Expand < 0 || p.Expand > maxExpand {
+		return nil, nil, opts, fmt.Errorf("'expand' must be between 0 and %d", maxExpand)
+	}
+	if p.Lambda != nil {
+		if *p.Lambda < 0 || *p.Lambda > 1 {
+			return nil, nil, opts, fmt.Errorf("'lambda' must be between 0 and 1")
+		}
+		opts.Lambda = *p.Lambda
+	}
+
+	// Build optional filters
+	var fromPtr, toPtr *string
+	if p.From != "" {
+		fromPtr = &p.From
+	}
+	if p.To != "" {
+		toPtr = &p.To
+	}
+	for key, value := range p.Metadata {
+		switch value.(type) {
+		case string, float64, bool:
+		default:
+			return nil, nil, opts, fmt.Errorf("metadata filter %q must be a string, number or boolean", key)
+		}
+	}
+	filter := BuildFilter(FilterParams{
+		Subject:  p.Subject,
+		Origin:   p.Origin,
+		Tags:     p.Tags,
+		Metadata: p.Metadata,
+		Language: p.Language,
+		From:     fromPtr,
+		To:       toPtr,
+	})
+
+	return collections, filter, opts, nil
+}
+
 func lookupHandler(w http.ResponseWriter, r *http.Request) {
 	var payload struct {
-		Query      string `json:"query"`
-		Collection string `json:"collection,omitempty"`
-		Subject    string `json:"subject,omitempty"`
-		From       string `json:"from,omitempty"` // ISO8601 timestamp
-		To         string `json:"to,omitempty"`
+		Query string `json:"query"`
+		lookupParams
 	}
 
 	// Decode input
@@ -64,26 +261,24 @@ func lookupHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid JSON or missing 'query' field", http.StatusBadRequest)
 		return
 	}
-
-	collection := payload.Collection
-	if collection == "" {
-		collection = "Database"
+	if !authorizeCollections(w, r, payload.requested()...) {
+		return
 	}
 
-	log.Printf("Performing vector lookup for: %s in collection: %s", payload.Query, collection)
-
-	// Build optional filters
-	var fromPtr, toPtr *string
-	if payload.From != "" {
-		fromPtr = &payload.From
-	}
-	if payload.To != "" {
-		toPtr = &payload.To
+	collections, filter, opts, err := payload.resolve()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-	filter := BuildFilter(payload.Subject, fromPtr, toPtr)
+
+	log.Printf("Performing vector lookup for: %s in collections: %s", payload.Query, strings.Join(collections, ", "))
 
 	// Call vector search
-	lookupResult, err := Lookup(payload.Query, collection, filter)
+	hits, err := Lookup(r.Context(), payload.Query, collections, filter, opts)
+	if errors.Is(err, ErrCollectionNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Lookup failed: %v", err), http.StatusInternalServerError)
 		return
@@ -91,46 +286,57 @@ func lookupHandler(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	if _, err := w.Write([]byte(lookupResult)); err != nil {
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+		"result": hits,
+	}); err != nil {
 		log.Printf("Error writing response: %v", err)
 	}
 }
 
 func createCollectionHandler(w http.ResponseWriter, r *http.Request) {
 	var payload struct {
-		Name string `json:"name"`
+		Name           string `json:"name"`
+		EmbeddingModel string `json:"embedding_model,omitempty"` // Defaults to EMBEDDING_MODEL
+		CollectionConfig
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.Name == "" {
 		http.Error(w, "Invalid JSON or missing 'name' field", http.StatusBadRequest)
 		return
 	}
-
-	url := fmt.Sprintf("http://192.168.178.136:30333/collections/%s", payload.Name)
-
-	body := map[string]interface{}{
-		"vectors": map[string]interface{}{
-			"size":     1536,
-			"distance": "Cosine",
-		},
+	if !authorizeCollections(w, r, payload.Name) {
+		return
 	}
 
-	jsonBody, _ := json.Marshal(body)
-
-	req, _ := http.NewRequest("PUT", url, bytes.NewBuffer(jsonBody))
-	req.Header.Set("Content-Type", "application/json")
+	model := payload.EmbeddingModel
+	if model == "" {
+		model = DefaultEmbeddingModel()
+	}
+	if EmbeddingDimension(model) == 0 {
+		http.Error(w, fmt.Sprintf("Unknown embedding model %q", model), http.StatusBadRequest)
+		return
+	}
+	if err := payload.CollectionConfig.Prepare(EmbeddingDimension(model)); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid collection config: %v", err), http.StatusBadRequest)
+		return
+	}
 
-	res, err := http.DefaultClient.Do(req)
+	info, err := registry.Create(r.Context(), payload.Name, model, payload.CollectionConfig)
+	if errors.Is(err, ErrCollectionExists) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Request error: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Failed to create collection: %v", err), http.StatusInternalServerError)
 		return
 	}
-	defer res.Body.Close()
 
-	respBody, _ := io.ReadAll(res.Body)
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(res.StatusCode)
-	w.Write(respBody)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":     "created",
+		"collection": info,
+	})
 }
 
 func deleteCollectionHandler(w http.ResponseWriter, r *http.Request) {
@@ -142,17 +348,28 @@ func deleteCollectionHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid JSON or missing 'name' field", http.StatusBadRequest)
 		return
 	}
+	if !authorizeCollections(w, r, payload.Name) || !authorizeUntenanted(w, r, "delete a collection") {
+		return
+	}
 
-	url := fmt.Sprintf("http://192.168.178.136:30333/collections/%s", payload.Name)
+	url := fmt.Sprintf("%s/collections/%s", qdrantBaseURL, payload.Name)
 
-	req, _ := http.NewRequest("DELETE", url, nil)
-	res, err := http.DefaultClient.Do(req)
+	req, _ := http.NewRequestWithContext(r.Context(), "DELETE", url, nil)
+	res, err := DoUpstream(req, qdrantPolicy)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Request error: %v", err), http.StatusInternalServerError)
 		return
 	}
 	defer res.Body.Close()
 
+	if res.StatusCode < 300 {
+		if err := registry.Remove(payload.Name); err != nil {
+			log.Printf("Error unregistering collection: %v", err)
+		}
+		// Qdrant drops the collection's aliases along with it.
+		registry.InvalidateAliases()
+	}
+
 	respBody, _ := io.ReadAll(res.Body)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(res.StatusCode)
@@ -169,8 +386,29 @@ func deletePointHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid JSON or missing fields 'collection' and 'point_id'", http.StatusBadRequest)
 		return
 	}
+	if !authorizeCollections(w, r, payload.Collection) {
+		return
+	}
+
+	// Deleting another tenant's point would quietly match nothing; say so instead.
+	if TenantFrom(r.Context()) != "" {
+		found := false
+		filter := map[string]interface{}{"must": []map[string]interface{}{{"has_id": []string{payload.PointID}}}}
+		err := ScrollQdrant(r.Context(), payload.Collection, filter, []string{}, false, func(points []SearchHit) error {
+			found = true
+			return nil
+		})
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to delete point: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.Error(w, fmt.Sprintf("Point %s not found", payload.PointID), http.StatusNotFound)
+			return
+		}
+	}
 
-	if err := DeletePointFromQdrant(payload.PointID, payload.Collection); err != nil {
+	if err := DeletePointFromQdrant(r.Context(), payload.PointID, payload.Collection); err != nil {
 		http.Error(w, fmt.Sprintf("Failed to delete point: %v", err), http.StatusInternalServerError)
 		return
 	}
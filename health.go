@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// healthHandler reports the circuit breaker state of every upstream. It answers
+// 503 only while Qdrant's breaker is open: without Qdrant nothing works, while
+// LLM outages are survivable (tagging falls back) and reported for information.
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	upstreams := BreakerStates()
+	qdrant := BreakerFor(qdrantBaseURL).name
+	status, code := "ok", http.StatusOK
+	for _, upstream := range upstreams {
+		if upstream.State == "closed" {
+			continue
+		}
+		if upstream.Upstream == qdrant {
+			status, code = "unavailable", http.StatusServiceUnavailable
+			break
+		}
+		status = "degraded"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":    status,
+		"upstreams": upstreams,
+	})
+}
+
+// cacheStatsHandler reports hit and miss counts for the caches in front of upstream calls.
+func cacheStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"embeddings": embeddingCache.Stats(),
+		"tags":       tagCache.Stats(),
+	})
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	maxUpstreamAttempts = 4
+	retryBaseDelay      = 250 * time.Millisecond
+	retryMaxDelay       = 8 * time.Second
+
+	breakerFailureThreshold = 5 // Consecutive failures that open the circuit
+	breakerOpenDuration     = 30 * time.Second
+)
+
+// ErrCircuitOpen is returned without calling an upstream whose breaker is open.
+var ErrCircuitOpen = errors.New("circuit open")
+
+// upstreamClient is shared by every outbound call. Per-call timeouts come from the
+// RetryPolicy; the transport only bounds connecting and waiting for headers so
+// streamed responses can run as long as they need.
+var upstreamClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 60 * time.Second,
+		MaxIdleConnsPerHost:   16,
+		IdleConnTimeout:       90 * time.Second,
+	},
+}
+
+// RetryPolicy controls how DoUpstream sends one logical call.
+type RetryPolicy struct {
+	Timeout        time.Duration // Per attempt, including reading the body; 0 means none
+	Idempotent     bool          // Safe to resend even if the upstream may have processed it
+	PassRateLimits bool          // Hand 429s back to the caller instead of retrying them
+}
+
+// DoUpstream sends req with jittered exponential backoff, guarded by the upstream's
+// circuit breaker. Network errors, 429 and 5xx are retried; a request that is not
+// idempotent is only resent when the upstream cannot have acted on it (connection
+// refused, 429, 503). The request body must be replayable (set by http.NewRequest
+// for in-memory bodies) to be retried.
+func DoUpstream(req *http.Request, policy RetryPolicy) (*http.Response, error) {
+	breaker := BreakerFor(req.URL.String())
+	attempts := maxUpstreamAttempts
+	if req.Body != nil && req.GetBody == nil {
+		attempts = 1
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			if err := sleepContext(req.Context(), backoffDelay(attempt, lastErr)); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := breaker.Allow(); err != nil {
+			return nil, err
+		}
+
+		resp, err := doAttempt(req, policy.Timeout)
+		if err != nil {
+			// A caller that hung up says nothing about the upstream's health.
+			if req.Context().Err() != nil {
+				breaker.Release()
+				return nil, err
+			}
+			breaker.Record(false)
+			lastErr = err
+			if !policy.Idempotent && !isDialError(err) {
+				return nil, err
+			}
+			log.Printf("Upstream %s: %v (attempt %d)", breaker.name, err, attempt+1)
+			continue
+		}
+
+		breaker.Record(resp.StatusCode < 500)
+		if !shouldRetryStatus(resp.StatusCode, policy) || attempt == attempts-1 {
+			return resp, nil
+		}
+
+		lastErr = &retryableStatus{status: resp.Status, retryAfter: resp.Header.Get("Retry-After")}
+		log.Printf("Upstream %s: %s (attempt %d)", breaker.name, resp.Status, attempt+1)
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	return nil, lastErr
+}
+
+// doAttempt sends a single attempt, bounding it by timeout until the body is closed.
+func doAttempt(req *http.Request, timeout time.Duration) (*http.Response, error) {
+	ctx, cancel := req.Context(), context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+
+	attempt := req.Clone(ctx)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		attempt.Body = body
+	}
+
+	resp, err := upstreamClient.Do(attempt)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+type retryableStatus struct {
+	status     string
+	retryAfter string
+}
+
+func (e *retryableStatus) Error() string { return "upstream returned " + e.status }
+
+func shouldRetryStatus(status int, policy RetryPolicy) bool {
+	switch {
+	case status == http.StatusTooManyRequests:
+		return !policy.PassRateLimits
+	case status == http.StatusServiceUnavailable:
+		return true
+	case status >= 500:
+		return policy.Idempotent
+	}
+	return false
+}
+
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// backoffDelay is full-jitter exponential backoff, stretched to honour Retry-After.
+func backoffDelay(attempt int, lastErr error) time.Duration {
+	ceiling := retryBaseDelay << (attempt - 1)
+	if ceiling > retryMaxDelay {
+		ceiling = retryMaxDelay
+	}
+	delay := time.Duration(rand.Int63n(int64(ceiling) + 1))
+
+	var status *retryableStatus
+	if errors.As(lastErr, &status) {
+		if wait, ok := parseRetryAfter(status.retryAfter); ok && wait > delay {
+			delay = wait
+		}
+	}
+	return delay
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// CircuitBreaker stops calls to an upstream after repeated failures, then lets a
+// single probe through once breakerOpenDuration has passed.
+type CircuitBreaker struct {
+	mu       sync.Mutex
+	name     string
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// BreakerState is the health view of one breaker.
+type BreakerState struct {
+	Upstream string     `json:"upstream"`
+	State    string     `json:"state"` // closed, open or half-open
+	Failures int        `json:"consecutive_failures"`
+	OpenedAt *time.Time `json:"opened_at,omitempty"`
+}
+
+var breakers = struct {
+	sync.Mutex
+	byHost map[string]*CircuitBreaker
+}{byHost: map[string]*CircuitBreaker{}}
+
+// BreakerFor returns the shared breaker for the host of rawURL.
+func BreakerFor(rawURL string) *CircuitBreaker {
+	host := rawURL
+	if parsed, err := url.Parse(rawURL); err == nil && parsed.Host != "" {
+		host = parsed.Host
+	}
+
+	breakers.Lock()
+	defer breakers.Unlock()
+
+	if breaker, ok := breakers.byHost[host]; ok {
+		return breaker
+	}
+	breaker := &CircuitBreaker{name: host}
+	breakers.byHost[host] = breaker
+	return breaker
+}
+
+// Allow reports whether a call may go out now.
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < breakerFailureThreshold {
+		return nil
+	}
+	if time.Since(b.openedAt) < breakerOpenDuration || b.probing {
+		return fmt.Errorf("%w: %s", ErrCircuitOpen, b.name)
+	}
+	b.probing = true
+	return nil
+}
+
+// Record feeds the outcome of a call back into the breaker.
+func (b *CircuitBreaker) Record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if success {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= breakerFailureThreshold {
+		b.openedAt = time.Now()
+	}
+}
+
+// Release ends a call without an outcome, freeing the half-open probe slot.
+func (b *CircuitBreaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state := BreakerState{Upstream: b.name, State: "closed", Failures: b.failures}
+	if b.failures >= breakerFailureThreshold {
+		openedAt := b.openedAt
+		state.OpenedAt = &openedAt
+		state.State = "open"
+		if b.probing || time.Since(b.openedAt) >= breakerOpenDuration {
+			state.State = "half-open"
+		}
+	}
+	return state
+}
+
+// BreakerStates lists every upstream breaker, sorted by name.
+func BreakerStates() []BreakerState {
+	// Register the known upstreams so they show up before their first call.
+	for _, upstream := range []string{qdrantBaseURL, openaiEmbeddingURL, groqAPIURL} {
+		BreakerFor(upstream)
+	}
+
+	breakers.Lock()
+	all := make([]*CircuitBreaker, 0, len(breakers.byHost))
+	for _, breaker := range breakers.byHost {
+		all = append(all, breaker)
+	}
+	breakers.Unlock()
+
+	states := make([]BreakerState, 0, len(all))
+	for _, breaker := range all {
+		states = append(states, breaker.State())
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Upstream < states[j].Upstream })
+	return states
+}
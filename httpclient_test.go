@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerOpensProbesAndCloses(t *testing.T) {
+	breaker := &CircuitBreaker{name: "test"}
+	expectState := func(step, want string) {
+		t.Helper()
+		if got := breaker.State().State; got != want {
+			t.Fatalf("%s: state = %s, want %s", step, got, want)
+		}
+	}
+
+	for i := 0; i < breakerFailureThreshold-1; i++ {
+		breaker.Record(false)
+	}
+	expectState("below threshold", "closed")
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("below threshold: %v", err)
+	}
+
+	breaker.Record(false)
+	expectState("threshold reached", "open")
+	if err := breaker.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("open breaker allowed a call: %v", err)
+	}
+
+	// Let the open period run out.
+	breaker.openedAt = time.Now().Add(-breakerOpenDuration)
+	expectState("after the open period", "half-open")
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("probe refused: %v", err)
+	}
+	if err := breaker.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("second call allowed during the probe: %v", err)
+	}
+
+	// A failed probe reopens the circuit for another period.
+	breaker.Record(false)
+	expectState("failed probe", "open")
+	if err := breaker.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("reopened breaker allowed a call: %v", err)
+	}
+
+	// A released probe frees the slot without an outcome.
+	breaker.openedAt = time.Now().Add(-breakerOpenDuration)
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("probe refused: %v", err)
+	}
+	breaker.Release()
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("probe refused after release: %v", err)
+	}
+
+	breaker.Record(true)
+	expectState("successful probe", "closed")
+	if err := breaker.Allow(); err != nil {
+		t.Fatalf("closed breaker refused: %v", err)
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	for attempt := 1; attempt <= 8; attempt++ {
+		ceiling := min(retryBaseDelay<<(attempt-1), retryMaxDelay)
+		for i := 0; i < 50; i++ {
+			if delay := backoffDelay(attempt, errors.New("boom")); delay < 0 || delay > ceiling {
+				t.Fatalf("attempt %d: delay %s outside [0, %s]", attempt, delay, ceiling)
+			}
+		}
+	}
+
+	rateLimited := &retryableStatus{status: "429 Too Many Requests", retryAfter: "20"}
+	if delay := backoffDelay(1, rateLimited); delay != 20*time.Second {
+		t.Errorf("Retry-After not honoured: %s", delay)
+	}
+	shortWait := &retryableStatus{status: "503 Service Unavailable", retryAfter: "0"}
+	if delay := backoffDelay(1, shortWait); delay > retryBaseDelay {
+		t.Errorf("a short Retry-After must not stretch the delay: %s", delay)
+	}
+}
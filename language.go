@@ -0,0 +1,164 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// undeterminedLanguage is the ISO 639 code for text whose language can't be told.
+const undeterminedLanguage = "und"
+
+// Names used when asking a model for tags in a given language.
+var languageNames = map[string]string{
+	"am": "Amharic", "ar": "Arabic", "bn": "Bengali", "de": "German", "el": "Greek",
+	"en": "English", "es": "Spanish", "fa": "Persian", "fr": "French", "gu": "Gujarati",
+	"he": "Hebrew", "hi": "Hindi", "hy": "Armenian", "it": "Italian", "ja": "Japanese",
+	"ka": "Georgian", "ko": "Korean", "nl": "Dutch", "pl": "Polish", "pt": "Portuguese",
+	"ru": "Russian", "sv": "Swedish", "ta": "Tamil", "te": "Telugu", "th": "Thai",
+	"tr": "Turkish", "uk": "Ukrainian", "ur": "Urdu", "zh": "Chinese",
+}
+
+// LanguageName returns the English name of an ISO 639-1 code, or the input if it isn't one.
+func LanguageName(code string) string {
+	if name, ok := languageNames[strings.ToLower(code)]; ok {
+		return name
+	}
+	return code
+}
+
+// Scripts that identify a single language well enough on their own.
+var scriptLanguages = []struct {
+	script   *unicode.RangeTable
+	language string
+}{
+	{unicode.Hangul, "ko"},
+	{unicode.Thai, "th"},
+	{unicode.Greek, "el"},
+	{unicode.Hebrew, "he"},
+	{unicode.Devanagari, "hi"},
+	{unicode.Bengali, "bn"},
+	{unicode.Tamil, "ta"},
+	{unicode.Telugu, "te"},
+	{unicode.Gujarati, "gu"},
+	{unicode.Georgian, "ka"},
+	{unicode.Armenian, "hy"},
+	{unicode.Ethiopic, "am"},
+}
+
+// DetectLanguage guesses the ISO 639-1 code of text: by script for non-Latin
+// writing systems, and by common function words for Latin-script languages.
+// It returns "und" when there is too little to go on.
+func DetectLanguage(text string) string {
+	counts := map[string]int{}
+	letters := 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		switch {
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			counts["kana"]++
+		case unicode.Is(unicode.Han, r):
+			counts["han"]++
+		case unicode.Is(unicode.Cyrillic, r):
+			counts["cyrillic"]++
+		case unicode.Is(unicode.Arabic, r):
+			counts["arabic"]++
+		case unicode.Is(unicode.Latin, r):
+			counts["latin"]++
+		default:
+			for _, candidate := range scriptLanguages {
+				if unicode.Is(candidate.script, r) {
+					counts[candidate.language]++
+					break
+				}
+			}
+		}
+	}
+	if letters == 0 {
+		return undeterminedLanguage
+	}
+
+	script, best := "", 0
+	for name, count := range counts {
+		if count > best || (count == best && name < script) {
+			script, best = name, count
+		}
+	}
+
+	switch script {
+	case "han", "kana":
+		// Japanese mixes kanji with kana; Chinese has none.
+		if counts["kana"] > 0 {
+			return "ja"
+		}
+		return "zh"
+	case "cyrillic":
+		if strings.ContainsAny(text, "іїєґІЇЄҐ") {
+			return "uk"
+		}
+		return "ru"
+	case "arabic":
+		if strings.ContainsAny(text, "ےٹڈڑں") {
+			return "ur"
+		}
+		if strings.ContainsAny(text, "پچژگی") {
+			return "fa"
+		}
+		return "ar"
+	case "latin":
+		return detectLatinLanguage(text)
+	}
+	return script
+}
+
+// Frequent function words of the Latin-script languages we tell apart.
+var latinStopwords = map[string][]string{
+	"en": strings.Fields("the and of to in is that it for was with as on are be this by not or from have"),
+	"de": strings.Fields("der die und das ist nicht ein eine zu den von mit sich des auf für im dem auch es"),
+	"fr": strings.Fields("le la les et des est une un du que pas pour dans qui sur au avec ce il sont"),
+	"es": strings.Fields("el la los las y de que en un una es por con para se del al no su lo"),
+	"it": strings.Fields("il la di che e un una per non sono con del della gli le nel è si anche ma"),
+	"pt": strings.Fields("o a os as e de que em um uma não para com do da se por mais no na"),
+	"nl": strings.Fields("de het een en van is dat niet in op te zijn voor met die ook er aan"),
+	"sv": strings.Fields("och att det som en är på för med av inte den till har var om de"),
+	"pl": strings.Fields("i w na nie z się do jest to że jak ale po co tak przez od dla"),
+	"tr": strings.Fields("ve bir bu da de için ile ne olarak çok daha gibi ama var mı en"),
+}
+
+var latinStopwordIndex = func() map[string][]string {
+	index := map[string][]string{}
+	for language, words := range latinStopwords {
+		for _, word := range words {
+			index[word] = append(index[word], language)
+		}
+	}
+	return index
+}()
+
+// Stopword hits needed before a Latin-script text is given a language; a lone
+// "a" or "de" says little, so such text stays undetermined.
+const minStopwordHits = 2
+
+func detectLatinLanguage(text string) string {
+	scores := map[string]int{}
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	}) {
+		for _, language := range latinStopwordIndex[word] {
+			scores[language]++
+		}
+	}
+
+	language, best := undeterminedLanguage, 0
+	for candidate, score := range scores {
+		if score > best || (score == best && candidate < language) {
+			language, best = candidate, score
+		}
+	}
+	if best < minStopwordHits {
+		return undeterminedLanguage
+	}
+	return language
+}
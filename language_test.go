@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestDetectLanguage(t *testing.T) {
+	tests := map[string]string{
+		"The cat sat on the mat and it was happy.": "en",
+		"Der Hund ist nicht in dem Haus.":          "de",
+		"a test!":                                  "und", // One stopword is not enough
+		"ok":                                       "und",
+		"これは日本語の文です。":                              "ja",
+		"Это русский текст.":                       "ru",
+	}
+	for text, want := range tests {
+		if got := DetectLanguage(text); got != want {
+			t.Errorf("DetectLanguage(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+func TestShortSentencesKeepDocumentLanguage(t *testing.T) {
+	text := "This is the first sentence of the document and it is in English. a test! The last one is also in English."
+	for _, chunk := range SentenceChunk(text, "test", ChunkOptions{}) {
+		if language := chunk.Metadata["language"]; language != "en" {
+			t.Errorf("chunk %q has language %v, want en", chunk.Sentence, language)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// ChatProvider describes an OpenAI-compatible chat completions endpoint.
+type ChatProvider struct {
+	URL       string
+	Model     string
+	APIKeyEnv string // Environment variable holding the API key
+}
+
+type ChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+const chatTimeout = 60 * time.Second
+
+var groqProvider = ChatProvider{URL: groqAPIURL, Model: groqModel, APIKeyEnv: "GROQ_API_KEY"}
+
+// estimateTokens is the fallback for CountTokens when no tokenizer is available.
+func estimateTokens(text string) int {
+	return len(text) / 4 // Rough estimation
+}
+
+// ChatCompletion sends messages to the provider and returns the first choice's content.
+func ChatCompletion(ctx context.Context, provider ChatProvider, messages []ChatMessage, temperature float64, maxTokens int) (string, error) {
+	return chatCompletion(ctx, provider, messages, temperature, maxTokens, nil)
+}
+
+// ChatCompletionJSON is ChatCompletion with the provider's JSON mode switched on,
+// so the reply is a single JSON object.
+func ChatCompletionJSON(ctx context.Context, provider ChatProvider, messages []ChatMessage, temperature float64, maxTokens int) (string, error) {
+	return chatCompletion(ctx, provider, messages, temperature, maxTokens, map[string]interface{}{
+		"response_format": map[string]string{"type": "json_object"},
+	})
+}
+
+func chatCompletion(ctx context.Context, provider ChatProvider, messages []ChatMessage, temperature float64, maxTokens int, extra map[string]interface{}) (string, error) {
+	resp, reservation, err := postChat(ctx, provider, messages, temperature, maxTokens, extra)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var response struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+		Usage tokenUsage `json:"usage"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return "", err
+	}
+	reservation.Settle(response.Usage.TotalTokens)
+
+	if len(response.Choices) == 0 {
+		return "", errors.New("no choices returned")
+	}
+
+	return strings.TrimSpace(response.Choices[0].Message.Content), nil
+}
+
+// StreamChatCompletion requests a streamed completion and calls onToken for every content delta.
+func StreamChatCompletion(ctx context.Context, provider ChatProvider, messages []ChatMessage, temperature float64, maxTokens int, onToken func(string) error) error {
+	resp, reservation, err := postChat(ctx, provider, messages, temperature, maxTokens, map[string]interface{}{
+		"stream":         true,
+		"stream_options": map[string]bool{"include_usage": true},
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Providers report usage in the final chunk; fall back to an estimate if they don't.
+	var usage tokenUsage
+	var streamed strings.Builder
+	defer func() {
+		if usage.TotalTokens == 0 {
+			usage.TotalTokens = countChatTokens(provider.Model, messages) + CountTokens(provider.Model, streamed.String())
+		}
+		reservation.Settle(usage.TotalTokens)
+	}()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			return nil
+		}
+
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+			Usage *tokenUsage `json:"usage"`
+			XGroq *struct {
+				Usage *tokenUsage `json:"usage"`
+			} `json:"x_groq"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("failed to decode stream chunk: %w", err)
+		}
+		if chunk.Usage != nil {
+			usage = *chunk.Usage
+		} else if chunk.XGroq != nil && chunk.XGroq.Usage != nil {
+			usage = *chunk.XGroq.Usage
+		}
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			continue
+		}
+		streamed.WriteString(chunk.Choices[0].Delta.Content)
+		if err := onToken(chunk.Choices[0].Delta.Content); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// postChat sends a chat completion request; extra adds provider options such as stream or response_format.
+// The returned reservation covers the prompt plus maxTokens and should be settled with the real usage.
+func postChat(ctx context.Context, provider ChatProvider, messages []ChatMessage, temperature float64, maxTokens int, extra map[string]interface{}) (*http.Response, *Reservation, error) {
+	payload := map[string]interface{}{
+		"model":       provider.Model,
+		"messages":    messages,
+		"temperature": temperature,
+		"max_tokens":  maxTokens,
+	}
+	for key, value := range extra {
+		payload[key] = value
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Completions have no side effects, so resending one only costs tokens.
+	// Streams are not bounded by a timeout as they last as long as the answer.
+	policy := RetryPolicy{Timeout: chatTimeout, Idempotent: true}
+	if payload["stream"] == true {
+		policy.Timeout = 0
+	}
+
+	resp, reservation, err := doRateLimited(ctx, provider.URL, countChatTokens(provider.Model, messages)+maxTokens, policy, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", provider.URL, bytes.NewBuffer(jsonData))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+os.Getenv(provider.APIKeyEnv))
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		reservation.Cancel()
+		return nil, nil, errors.New(string(bodyBytes))
+	}
+
+	return resp, reservation, nil
+}
+
+// tokenUsage is the usage block of OpenAI-compatible responses.
+type tokenUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+func countChatTokens(model string, messages []ChatMessage) int {
+	total := 0
+	for _, message := range messages {
+		total += CountTokens(model, message.Content) + 4 // Per-message framing
+	}
+	return total
+}
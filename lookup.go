@@ -2,131 +2,249 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
-	"os"
+	"sort"
 	"strings"
-	"time"
+	"sync"
 )
 
-const openaiEmbeddingURL = "https://api.openai.com/v1/embeddings"
-const openaiEmbeddingModel = "text-embedding-3-small"
-
-var qdrantSearchURL = ""
+const defaultLookupLimit = 20
+const mmrCandidateFactor = 4 // Candidates fetched per requested result when re-ranking
 
 var LookupSystemPrompt = `You are a semantic tag generator.
 Given several numbered chunks of text, output a corresponding list of tag groups.
 Each tag group should contain only the 1–2 most relevant and distinct tags summarizing the core topics of the chunk.
 Use only lowercase where possible. Separate each tag with '|'. Return one line per chunk, tags only.`
 
-// GetEmbeddingFromOpenAI fetches the embedding for a given string using OpenAI API.
-func GetEmbeddingFromOpenAI(text string) ([]float32, error) {
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	if apiKey == "" {
-		return nil, fmt.Errorf("OPENAI_API_KEY not set")
-	}
-
-	payload := map[string]interface{}{
-		"input": text,
-		"model": openaiEmbeddingModel,
+// Lookup performs a similarity search in Qdrant with a given query string.
+// When several collections are given they are searched concurrently and merged
+// by similarity, see mergeCollectionHits.
+func Lookup(ctx context.Context, query string, collections []string, filters map[string]interface{}, opts LookupOptions) ([]SearchHit, error) {
+	if opts.Limit <= 0 {
+		opts.Limit = defaultLookupLimit
 	}
 
-	jsonData, err := json.Marshal(payload)
+	queries, err := ExpandQuery(ctx, query, opts.Expansion, opts.NumQueries)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := http.NewRequest("POST", openaiEmbeddingURL, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, err
+	// Collections may use different models, so embed the queries once per model.
+	embeddingsByModel := map[string][][]float32{}
+	collectionEmbeddings := make([][][]float32, len(collections))
+	distances := make([]string, len(collections))
+	models := map[string]bool{}
+	for c, collection := range collections {
+		info, err := registry.Get(ctx, collection)
+		if err != nil {
+			return nil, err
+		}
+		distances[c] = info.Distance
+
+		model := info.EmbeddingModel
+		if model == "" {
+			model = DefaultEmbeddingModel()
+		}
+		models[model] = true
+		if _, ok := embeddingsByModel[model]; !ok {
+			embeddings := make([][]float32, len(queries))
+			for i, text := range queries {
+				embeddings[i], err = GetEmbedding(ctx, text, model)
+				if err != nil {
+					return nil, fmt.Errorf("embedding error: %v", err)
+				}
+			}
+			embeddingsByModel[model] = embeddings
+		}
+		collectionEmbeddings[c] = embeddingsByModel[model]
 	}
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
+	// Over-fetch when results get re-selected, so there is something to choose from.
+	candidates := opts.Limit
+	if opts.MMR || opts.MaxPerOrigin > 0 {
+		candidates = opts.Limit * mmrCandidateFactor
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, errors.New(string(bodyBytes))
+	// rankings[c][q] holds the hits of query q in collection c.
+	rankings := make([][][]SearchHit, len(collections))
+	errs := make([]error, len(collections)*len(queries))
+	var wg sync.WaitGroup
+	for c, collection := range collections {
+		rankings[c] = make([][]SearchHit, len(queries))
+		for q, embedding := range collectionEmbeddings[c] {
+			wg.Add(1)
+			go func(c, q int, collection string, embedding []float32) {
+				defer wg.Done()
+				hits, err := SearchQdrant(ctx, collection, embedding, filters, candidates, opts.MMR)
+				if err != nil {
+					errs[c*len(queries)+q] = fmt.Errorf("collection %s: %w", collection, err)
+					return
+				}
+				for i := range hits {
+					hits[i].Collection = collection
+					hits[i].Score = similarityScore(distances[c], hits[i].Score)
+				}
+				rankings[c][q] = hits
+			}(c, q, collection, embedding)
+		}
 	}
+	wg.Wait()
 
-	var response struct {
-		Data []struct {
-			Embedding []float32 `json:"embedding"`
-		} `json:"data"`
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return nil, err
+
+	comparable := len(models) == 1
+	for _, distance := range distances {
+		comparable = comparable && qdrantDistance(distance) == qdrantDistance(distances[0])
+	}
+	hits := mergeCollectionHits(rankings, comparable)
+
+	if opts.MMR {
+		hits = SelectMMR(hits, opts.Limit, opts.Lambda, opts.MaxPerOrigin)
+	} else if opts.MaxPerOrigin > 0 {
+		hits = CapPerOrigin(hits, opts.Limit, opts.MaxPerOrigin)
+	}
+	if len(hits) > opts.Limit {
+		hits = hits[:opts.Limit]
 	}
 
-	if len(response.Data) == 0 {
-		return nil, errors.New("no embedding returned")
+	// Vectors are only fetched for re-ranking, don't send them back.
+	for i := range hits {
+		hits[i].Vector = nil
 	}
 
-	return response.Data[0].Embedding, nil
+	if opts.Expand > 0 {
+		return ExpandHits(ctx, hits, opts.Expand)
+	}
+
+	return hits, nil
 }
 
-// Lookup performs a similarity search in Qdrant with a given query string.
-func Lookup(query string, collection string, filters map[string]interface{}) (string, error) {
-	qdrantSearchURL = fmt.Sprintf("http://192.168.178.136:30333/collections/%s/points/search", collection)
-	embedding, err := GetEmbeddingFromOpenAI(query)
-	if err != nil {
-		return "", fmt.Errorf("embedding error: %v", err)
+// similarityScore turns a Qdrant score into one where higher is better. Euclid and
+// Manhattan collections return distances, mapped to 1/(1+d) in (0, 1].
+func similarityScore(distance string, score float64) float64 {
+	switch distance {
+	case "Euclid", "Manhattan":
+		return 1 / (1 + score)
+	}
+	return score
+}
+
+// qdrantDistance is the distance a collection scores with, Cosine when unrecorded.
+func qdrantDistance(distance string) string {
+	if distance == "" {
+		return "Cosine"
+	}
+	return distance
+}
+
+// mergeCollectionHits fuses each collection's per-query rankings and merges the
+// collections into one list, best first. rankings[c][q] holds similarity scores.
+// A single collection keeps FuseRankings' scores.
+//
+// Scores stay anchored to similarity rather than being rescaled per collection, so a
+// collection whose best hit is poor can't place it level with the genuinely best
+// result. With several queries a collection keeps its fused order, scaled by its best
+// similarity. Collections that don't share a model and distance score on different
+// scales; they are divided by the best similarity across all of them.
+func mergeCollectionHits(rankings [][][]SearchHit, comparable bool) []SearchHit {
+	var hits []SearchHit
+	best := math.Inf(-1)
+	for _, collectionRankings := range rankings {
+		collectionBest := math.Inf(-1)
+		for _, ranking := range collectionRankings {
+			for _, hit := range ranking {
+				collectionBest = math.Max(collectionBest, hit.Score)
+			}
+		}
+		best = math.Max(best, collectionBest)
+
+		// A single ranking comes back unchanged, scored by similarity already; fused
+		// scores are relative to the collection's top hit.
+		collectionHits := FuseRankings(collectionRankings)
+		if len(rankings) > 1 && len(collectionRankings) > 1 {
+			for i := range collectionHits {
+				collectionHits[i].Score *= math.Max(collectionBest, 0)
+			}
+		}
+		hits = append(hits, collectionHits...)
 	}
 
+	if !comparable && len(rankings) > 1 && best > 0 {
+		for i := range hits {
+			hits[i].Score /= best
+		}
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool {
+		return hits[i].Score > hits[j].Score
+	})
+	return hits
+}
+
+// SearchQdrant runs a raw vector search against a collection and returns the parsed hits.
+func SearchQdrant(ctx context.Context, collection string, vector []float32, filters map[string]interface{}, limit int, withVector bool) ([]SearchHit, error) {
+	url := fmt.Sprintf("%s/collections/%s/points/search", qdrantBaseURL, collection)
+
 	payload := map[string]interface{}{
-		"vector":       embedding,
-		"limit":        20,
+		"vector":       qdrantSearchVector(ctx, collection, vector),
+		"limit":        limit,
 		"with_payload": true,
+		"with_vector":  qdrantWithVector(ctx, collection, withVector),
 	}
 
-	if filters != nil {
+	if filters = tenantFilter(ctx, filters); filters != nil {
 		payload["filter"] = filters
 	}
 
 	jsonPayload, _ := json.Marshal(payload)
 
-	req, err := http.NewRequest("POST", qdrantSearchURL, bytes.NewBuffer(jsonPayload))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonPayload))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := DoUpstream(req, qdrantPolicy)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	body, _ := io.ReadAll(resp.Body)
-	fmt.Printf("Qdrant responsed")
-	return string(body), nil
+	if resp.StatusCode >= 300 {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("qdrant search failed: %s: %s", resp.Status, string(bodyBytes))
+	}
+
+	var response struct {
+		Result []qdrantPoint `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode search response: %w", err)
+	}
+
+	return decodeHits(ctx, collection, response.Result)
 }
 
 // GenerateLookupTags takes a slice of chunk texts and returns a slice of tag lists.
-func GenerateLookupTags(chunkTexts []string) ([][]string, error) {
+func GenerateLookupTags(ctx context.Context, chunkTexts []string) ([][]string, error) {
 	if len(chunkTexts) == 0 {
 		return [][]string{}, nil
 	}
 
-	const tokenLimit = 1800              // Max tokens per request to avoid 6k TPM issue
-	const tokensPerMinuteLimit = 6000    // Free tier Groq limit
-	var totalTokensUsed = 0              // For throttling
-	var lastFlush time.Time = time.Now() // For rate limiting
+	const tokenLimit = 1800 // Max tokens per request to avoid 6k TPM issue
 
 	var allTags [][]string
 	var inputBuilder strings.Builder
 	var currentBatch []string
-	estimateTokens := func(text string) int {
-		return len(text) / 4 // Rough estimation
-	}
 
 	flushBatch := func() error {
 		if len(currentBatch) == 0 {
@@ -136,62 +254,14 @@ func GenerateLookupTags(chunkTexts []string) ([][]string, error) {
 		userMessage := inputBuilder.String()
 		inputBuilder.Reset()
 
-		totalTokensUsed += estimateTokens(userMessage)
-		if totalTokensUsed > tokensPerMinuteLimit {
-			sinceLast := time.Since(lastFlush)
-			if sinceLast < time.Minute {
-				time.Sleep(time.Minute - sinceLast)
-			}
-			totalTokensUsed = estimateTokens(userMessage)
-			lastFlush = time.Now()
-		}
-
-		payload := map[string]interface{}{
-			"model": groqModel,
-			"messages": []map[string]string{
-				{"role": "system", "content": tagSystemPrompt},
-				{"role": "user", "content": userMessage},
-			},
-			"temperature": 0.3,
-			"max_tokens":  2048,
-		}
-
-		jsonData, err := json.Marshal(payload)
-		if err != nil {
-			return err
-		}
-
-		req, err := http.NewRequest("POST", groqAPIURL, bytes.NewBuffer(jsonData))
-		if err != nil {
-			return err
-		}
-		req.Header.Set("Authorization", "Bearer "+os.Getenv("GROQ_API_KEY"))
-		req.Header.Set("Content-Type", "application/json")
-
-		resp, err := http.DefaultClient.Do(req)
-		if err != nil {
-			return err
-		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != http.StatusOK {
-			bodyBytes, _ := io.ReadAll(resp.Body)
-			return errors.New(string(bodyBytes))
-		}
-
-		var response struct {
-			Choices []struct {
-				Message struct {
-					Content string `json:"content"`
-				} `json:"message"`
-			} `json:"choices"`
-		}
-		err = json.NewDecoder(resp.Body).Decode(&response)
+		rawOutput, err := ChatCompletion(ctx, groqProvider, []ChatMessage{
+			{Role: "system", Content: tagSystemPrompt},
+			{Role: "user", Content: userMessage},
+		}, 0.3, 2048)
 		if err != nil {
 			return err
 		}
 
-		rawOutput := strings.TrimSpace(response.Choices[0].Message.Content)
 		batchTags := ParseLookupTags(rawOutput)
 		allTags = append(allTags, batchTags...)
 		currentBatch = nil
@@ -200,7 +270,7 @@ func GenerateLookupTags(chunkTexts []string) ([][]string, error) {
 
 	var tokenCount int
 	for i, text := range chunkTexts {
-		estTokens := estimateTokens(text)
+		estTokens := CountTokens(groqModel, text)
 		if tokenCount+estTokens > tokenLimit {
 			if err := flushBatch(); err != nil {
 				return nil, err
@@ -248,25 +318,97 @@ func ParseLookupTags(input string) [][]string {
 	return result
 }
 
-func BuildFilter(subject string, from, to *string) map[string]interface{} {
+// FilterParams lists the payload conditions a lookup can be restricted by.
+type FilterParams struct {
+	Subject  string
+	Origin   string
+	Tags     []string               // Matches chunks carrying any of these tags
+	Metadata map[string]interface{} // Exact matches on metadata keys
+	Language string                 // Language detected at ingest, stored as metadata.language
+	From     *string                // ISO8601 lower bound on timestamp
+	To       *string                // ISO8601 upper bound on timestamp
+	TenantID string                 // Set by tenantFilter, not from request input
+}
+
+func BuildFilter(params FilterParams) map[string]interface{} {
 	must := []map[string]interface{}{}
 
-	if subject != "" {
+	if params.TenantID != "" {
+		must = append(must, map[string]interface{}{
+			"key": tenantField,
+			"match": map[string]string{
+				"value": params.TenantID,
+			},
+		})
+	}
+
+	if params.Subject != "" {
 		must = append(must, map[string]interface{}{
 			"key": "subject",
 			"match": map[string]string{
-				"value": subject,
+				"value": params.Subject,
+			},
+		})
+	}
+
+	if params.Origin != "" {
+		// Points merged as duplicates list their other origins under "origins".
+		must = append(must, map[string]interface{}{
+			"should": []map[string]interface{}{
+				{"key": "origin", "match": map[string]string{"value": params.Origin}},
+				{"key": "origins", "match": map[string]string{"value": params.Origin}},
+			},
+		})
+	}
+
+	if len(params.Tags) > 0 {
+		must = append(must, map[string]interface{}{
+			"key": "tags",
+			"match": map[string]interface{}{
+				"any": params.Tags,
+			},
+		})
+	}
+
+	keys := make([]string, 0, len(params.Metadata))
+	for key := range params.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := params.Metadata[key]
+		// Qdrant only matches keywords, integers and booleans exactly; pin fractional numbers with a range.
+		if number, ok := value.(float64); ok && number != math.Trunc(number) {
+			must = append(must, map[string]interface{}{
+				"key":   "metadata." + key,
+				"range": map[string]float64{"gte": number, "lte": number},
+			})
+			continue
+		}
+		must = append(must, map[string]interface{}{
+			"key": "metadata." + key,
+			"match": map[string]interface{}{
+				"value": value,
+			},
+		})
+	}
+
+	if params.Language != "" {
+		must = append(must, map[string]interface{}{
+			"key": "metadata.language",
+			"match": map[string]string{
+				"value": strings.ToLower(params.Language),
 			},
 		})
 	}
 
-	if from != nil || to != nil {
+	if params.From != nil || params.To != nil {
 		rangeFilter := map[string]string{}
-		if from != nil {
-			rangeFilter["gte"] = *from
+		if params.From != nil {
+			rangeFilter["gte"] = *params.From
 		}
-		if to != nil {
-			rangeFilter["lte"] = *to
+		if params.To != nil {
+			rangeFilter["lte"] = *params.To
 		}
 		must = append(must, map[string]interface{}{
 			"key":   "timestamp",
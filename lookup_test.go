@@ -0,0 +1,63 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func ranking(collection string, scores ...float64) []SearchHit {
+	hits := make([]SearchHit, len(scores))
+	for i, score := range scores {
+		hits[i] = SearchHit{ID: collection + string(rune('a'+i)), Score: score, Collection: collection}
+	}
+	return hits
+}
+
+func TestMergeCollectionHits(t *testing.T) {
+	type scored struct {
+		id    string
+		score float64
+	}
+	tests := []struct {
+		name       string
+		rankings   [][][]SearchHit
+		comparable bool
+		want       []scored
+	}{
+		{
+			"lone weak hit stays weak",
+			[][][]SearchHit{{ranking("x", 0.9, 0.5)}, {ranking("y", 0.3)}},
+			true,
+			[]scored{{"xa", 0.9}, {"xb", 0.5}, {"ya", 0.3}},
+		},
+		{
+			"different scales divide by the best overall",
+			[][][]SearchHit{{ranking("x", 0.8, 0.4)}, {ranking("y", 0.2)}},
+			false,
+			[]scored{{"xa", 1}, {"xb", 0.5}, {"ya", 0.25}},
+		},
+		{
+			"fused rankings scale by the collection's best",
+			[][][]SearchHit{{ranking("x", 0.9, 0.7), ranking("x", 0.8)}, {ranking("y", 0.4), ranking("y", 0.3)}},
+			true,
+			[]scored{{"xa", 0.9}, {"xb", 0.9 * (1.0 / 62) / (2.0 / 61)}, {"ya", 0.4}},
+		},
+		{
+			"single collection keeps its scores",
+			[][][]SearchHit{{ranking("x", 0.3, 0.1)}},
+			false,
+			[]scored{{"xa", 0.3}, {"xb", 0.1}},
+		},
+	}
+	for _, test := range tests {
+		hits := mergeCollectionHits(test.rankings, test.comparable)
+		if len(hits) != len(test.want) {
+			t.Fatalf("%s: got %d hits, want %d", test.name, len(hits), len(test.want))
+		}
+		for i, want := range test.want {
+			if hits[i].ID != want.id || math.Abs(hits[i].Score-want.score) > 1e-9 {
+				t.Errorf("%s: hit %d = %v %.4f, want %s %.4f", test.name, i, hits[i].ID, hits[i].Score, want.id, want.score)
+			}
+		}
+	}
+}
@@ -11,11 +11,16 @@ var httpPort = os.Getenv("PORT")
 
 func enableCORS(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Allow all origins
-		w.Header().Set("Access-Control-Allow-Origin", "*")
+		// Only origins listed in CORS_ORIGINS may call from a browser
+		if origin := r.Header.Get("Origin"); corsOrigins["*"] {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else if corsOrigins[origin] {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Add("Vary", "Origin")
+		}
 		// Allow specific headers and methods
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, X-Tenant-ID")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
 
 		// Handle preflight
 		if r.Method == "OPTIONS" {
@@ -28,11 +33,34 @@ func enableCORS(next http.HandlerFunc) http.HandlerFunc {
 }
 
 func main() {
-	http.HandleFunc("/chunk", enableCORS(chunkHandler))
-	http.HandleFunc("/lookup", enableCORS(lookupHandler))
-	http.HandleFunc("/create-collection", enableCORS(createCollectionHandler))
-	http.HandleFunc("/delete-collection", enableCORS(deleteCollectionHandler))
-	http.HandleFunc("/delete-point", enableCORS(deletePointHandler))
+	auth, err := LoadAuthenticator()
+	if err != nil {
+		log.Fatalf("Auth config: %v", err)
+	}
+	if auth == nil {
+		log.Println("⚠️ Authentication is off: set AUTH_KEYS_FILE or JWT_SECRET")
+	}
+	authenticator = auth
+
+	http.HandleFunc("/chunk", enableCORS(requireScope(scopeWrite, chunkHandler)))
+	http.HandleFunc("/lookup", enableCORS(requireScope(scopeRead, lookupHandler)))
+	http.HandleFunc("/ask", enableCORS(requireScope(scopeRead, askHandler)))
+	http.HandleFunc("/create-collection", enableCORS(requireScope(scopeAdmin, createCollectionHandler)))
+	http.HandleFunc("/delete-collection", enableCORS(requireScope(scopeAdmin, deleteCollectionHandler)))
+	http.HandleFunc("/delete-point", enableCORS(requireScope(scopeWrite, deletePointHandler)))
+	http.HandleFunc("/collections", enableCORS(requireScope(scopeRead, listCollectionsHandler)))
+	http.HandleFunc("/collections/{name}", enableCORS(requireScope(scopeRead, getCollectionHandler)))
+	http.HandleFunc("/collections/{name}/stats", enableCORS(requireScope(scopeRead, collectionStatsHandler)))
+	http.HandleFunc("/collections/{name}/index", enableCORS(requireScope(scopeWrite, createIndexHandler)))
+	http.HandleFunc("/collections/{name}/export", enableCORS(requireScope(scopeRead, exportCollectionHandler)))
+	http.HandleFunc("/collections/{name}/import", enableCORS(requireScope(scopeWrite, importCollectionHandler)))
+	http.HandleFunc("/collections/{name}/tenant", enableCORS(requireScope(scopeAdmin, assignTenantHandler)))
+	http.HandleFunc("/aliases", enableCORS(requireScope(scopeRead, aliasesHandler)))
+	http.HandleFunc("/aliases/{alias}", enableCORS(requireScope(scopeAdmin, deleteAliasHandler)))
+	http.HandleFunc("/migrations", enableCORS(requireScope(scopeRead, migrationsHandler)))
+	http.HandleFunc("/migrations/{id}", enableCORS(requireScope(scopeRead, getMigrationHandler)))
+	http.HandleFunc("/health", enableCORS(healthHandler)) // Left open for load balancers
+	http.HandleFunc("/caches", enableCORS(requireScope(scopeRead, cacheStatsHandler)))
 	fmt.Println("🧠 Chisel API running on port " + httpPort)
 	log.Fatal(http.ListenAndServe(":"+httpPort, nil))
 }
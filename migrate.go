@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const migrationBatchSize = 64
+
+// MigrationStatus reports the progress of a migration job.
+type MigrationStatus struct {
+	ID             string     `json:"id"`
+	Source         string     `json:"source"`
+	Target         string     `json:"target"`
+	EmbeddingModel string     `json:"embedding_model"`
+	Alias          string     `json:"alias,omitempty"`
+	Status         string     `json:"status"` // running, completed or failed
+	Total          int        `json:"total"`
+	Processed      int        `json:"processed"`
+	Skipped        int        `json:"skipped"` // Points without text to re-embed
+	Error          string     `json:"error,omitempty"`
+	StartedAt      time.Time  `json:"started_at"`
+	FinishedAt     *time.Time `json:"finished_at,omitempty"`
+}
+
+// MigrationJob re-embeds every point of one collection into another.
+type MigrationJob struct {
+	mu     sync.Mutex
+	status MigrationStatus
+}
+
+var migrations = struct {
+	sync.RWMutex
+	jobs map[string]*MigrationJob
+}{jobs: map[string]*MigrationJob{}}
+
+// Snapshot returns a copy of the job status that is safe to encode while it runs.
+func (j *MigrationJob) Snapshot() MigrationStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.status
+}
+
+func (j *MigrationJob) update(fn func(status *MigrationStatus)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	fn(&j.status)
+}
+
+func (j *MigrationJob) finish(err error) {
+	j.update(func(status *MigrationStatus) {
+		now := time.Now()
+		status.FinishedAt = &now
+		if err != nil {
+			status.Status = "failed"
+			status.Error = err.Error()
+			return
+		}
+		status.Status = "completed"
+	})
+	if err != nil {
+		log.Printf("Migration %s failed: %v", j.status.ID, err)
+	} else {
+		log.Printf("Migration %s completed", j.status.ID)
+	}
+}
+
+// StartMigration creates the target collection and re-embeds the source into it in the background.
+func StartMigration(ctx context.Context, source, target, model, alias string, config CollectionConfig) (*MigrationJob, error) {
+	if _, err := registry.Get(ctx, source); err != nil {
+		return nil, err
+	}
+
+	total, err := CountQdrantPoints(ctx, source, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := registry.Create(ctx, target, model, config); err != nil {
+		return nil, fmt.Errorf("failed to create target collection: %w", err)
+	}
+
+	job := &MigrationJob{status: MigrationStatus{
+		ID:             uuid.New().String(),
+		Source:         source,
+		Target:         target,
+		EmbeddingModel: model,
+		Alias:          alias,
+		Status:         "running",
+		Total:          total,
+		StartedAt:      time.Now(),
+	}}
+
+	migrations.Lock()
+	migrations.jobs[job.status.ID] = job
+	migrations.Unlock()
+
+	// The job outlives the request that started it.
+	go func() {
+		job.finish(runMigration(context.Background(), job, job.Snapshot()))
+	}()
+
+	return job, nil
+}
+
+// runMigration copies the points, reporting progress on job. spec holds the job's fixed settings.
+func runMigration(ctx context.Context, job *MigrationJob, spec MigrationStatus) error {
+	log.Printf("Migration %s: re-embedding %s into %s with %s", spec.ID, spec.Source, spec.Target, spec.EmbeddingModel)
+
+	err := ScrollQdrant(ctx, spec.Source, nil, nil, false, func(points []SearchHit) error {
+		for start := 0; start < len(points); start += migrationBatchSize {
+			end := start + migrationBatchSize
+			if end > len(points) {
+				end = len(points)
+			}
+
+			var batch []map[string]interface{}
+			skipped := 0
+			for _, point := range points[start:end] {
+				text := payloadString(point.Payload, "text")
+				if text == "" {
+					skipped++
+					continue
+				}
+
+				embedding, err := GetEmbedding(ctx, text, spec.EmbeddingModel)
+				if err != nil {
+					return fmt.Errorf("embedding point %v: %w", point.ID, err)
+				}
+
+				batch = append(batch, map[string]interface{}{
+					"id":      point.ID,
+					"vector":  qdrantPointVector(ctx, spec.Target, embedding),
+					"payload": point.Payload,
+				})
+			}
+
+			if len(batch) > 0 {
+				if err := UpsertQdrantPoints(ctx, spec.Target, batch); err != nil {
+					return err
+				}
+			}
+
+			job.update(func(status *MigrationStatus) {
+				status.Processed += len(batch)
+				status.Skipped += skipped
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if spec.Alias != "" {
+		if err := SwapQdrantAlias(ctx, spec.Alias, spec.Target); err != nil {
+			return fmt.Errorf("alias swap failed: %w", err)
+		}
+		registry.InvalidateAliases()
+		log.Printf("Migration %s: alias %s now points at %s", spec.ID, spec.Alias, spec.Target)
+	}
+
+	return nil
+}
+
+// migrationsHandler starts a migration on POST and lists migrations on GET.
+func migrationsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		if authorizeScope(w, r, scopeAdmin) && authorizeUntenanted(w, r, "migrate a collection") {
+			startMigrationHandler(w, r)
+		}
+	case http.MethodGet:
+		listMigrationsHandler(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func startMigrationHandler(w http.ResponseWriter, r *http.Request) {
+	var payload struct {
+		Source         string           `json:"source"`
+		Target         string           `json:"target"`
+		EmbeddingModel string           `json:"embedding_model"`
+		Alias          string           `json:"alias,omitempty"` // Repointed at target once done
+		Config         CollectionConfig `json:"config,omitempty"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.Source == "" || payload.Target == "" || payload.EmbeddingModel == "" {
+		http.Error(w, "Invalid JSON or missing fields 'source', 'target' and 'embedding_model'", http.StatusBadRequest)
+		return
+	}
+	if !authorizeCollections(w, r, payload.Source, payload.Target) {
+		return
+	}
+	if payload.Alias != "" && !authorizeCollections(w, r, payload.Alias) {
+		return
+	}
+	if payload.Source == payload.Target {
+		http.Error(w, "'source' and 'target' must differ", http.StatusBadRequest)
+		return
+	}
+	if EmbeddingDimension(payload.EmbeddingModel) == 0 {
+		http.Error(w, fmt.Sprintf("Unknown embedding model %q", payload.EmbeddingModel), http.StatusBadRequest)
+		return
+	}
+	if err := payload.Config.Prepare(EmbeddingDimension(payload.EmbeddingModel)); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid collection config: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	job, err := StartMigration(r.Context(), payload.Source, payload.Target, payload.EmbeddingModel, payload.Alias, payload.Config)
+	if errors.Is(err, ErrCollectionNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, ErrCollectionExists) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to start migration: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job.Snapshot())
+}
+
+func listMigrationsHandler(w http.ResponseWriter, r *http.Request) {
+	id := IdentityFrom(r.Context())
+	migrations.RLock()
+	jobs := make([]MigrationStatus, 0, len(migrations.jobs))
+	for _, job := range migrations.jobs {
+		status := job.Snapshot()
+		if id.CanAccess(status.Source) && id.CanAccess(status.Target) {
+			jobs = append(jobs, status)
+		}
+	}
+	migrations.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(jobs)
+}
+
+func getMigrationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	migrations.RLock()
+	job, ok := migrations.jobs[r.PathValue("id")]
+	migrations.RUnlock()
+	if !ok {
+		http.Error(w, "Migration not found", http.StatusNotFound)
+		return
+	}
+	status := job.Snapshot()
+	if !authorizeCollections(w, r, status.Source, status.Target) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+const defaultMMRLambda = 0.7
+
+// SelectMMR picks up to limit hits using maximal marginal relevance.
+// Each step takes the candidate that best balances its own score against its
+// similarity to what was already selected. maxPerOrigin caps hits per origin (0 = no cap).
+func SelectMMR(candidates []SearchHit, limit int, lambda float64, maxPerOrigin int) []SearchHit {
+	if limit <= 0 || len(candidates) == 0 {
+		return []SearchHit{}
+	}
+
+	vectors := make([][]float64, len(candidates))
+	for i, hit := range candidates {
+		vectors[i] = normalizeVector(hit.Vector)
+	}
+
+	// maxSim[i] tracks the highest similarity of candidate i to any selected hit.
+	maxSim := make([]float64, len(candidates))
+	used := make([]bool, len(candidates))
+	perOrigin := map[string]int{}
+	selected := []SearchHit{}
+
+	for len(selected) < limit {
+		best := -1
+		bestScore := math.Inf(-1)
+
+		for i, hit := range candidates {
+			if used[i] {
+				continue
+			}
+			if maxPerOrigin > 0 && perOrigin[hitOrigin(hit)] >= maxPerOrigin {
+				continue
+			}
+
+			score := lambda*hit.Score - (1-lambda)*maxSim[i]
+			if score > bestScore {
+				best = i
+				bestScore = score
+			}
+		}
+
+		if best < 0 {
+			break
+		}
+
+		used[best] = true
+		perOrigin[hitOrigin(candidates[best])]++
+		selected = append(selected, candidates[best])
+
+		for i := range candidates {
+			if used[i] {
+				continue
+			}
+			if sim := dotProduct(vectors[i], vectors[best]); sim > maxSim[i] {
+				maxSim[i] = sim
+			}
+		}
+	}
+
+	return selected
+}
+
+// CapPerOrigin keeps hits in score order, skipping any beyond maxPerOrigin for the same origin.
+func CapPerOrigin(hits []SearchHit, limit int, maxPerOrigin int) []SearchHit {
+	perOrigin := map[string]int{}
+	result := []SearchHit{}
+
+	for _, hit := range hits {
+		if len(result) >= limit {
+			break
+		}
+		origin := hitOrigin(hit)
+		if perOrigin[origin] >= maxPerOrigin {
+			continue
+		}
+		perOrigin[origin]++
+		result = append(result, hit)
+	}
+
+	return result
+}
+
+func hitOrigin(hit SearchHit) string {
+	if origin, ok := hit.Payload["origin"]; ok {
+		return fmt.Sprint(origin)
+	}
+	return ""
+}
+
+func normalizeVector(v []float32) []float64 {
+	out := make([]float64, len(v))
+	var norm float64
+	for i, x := range v {
+		out[i] = float64(x)
+		norm += float64(x) * float64(x)
+	}
+	if norm == 0 {
+		return out
+	}
+	norm = math.Sqrt(norm)
+	for i := range out {
+		out[i] /= norm
+	}
+	return out
+}
+
+func dotProduct(a, b []float64) float64 {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	var sum float64
+	for i := 0; i < n; i++ {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func mmrHit(id string, score float64, origin string, vector ...float32) SearchHit {
+	return SearchHit{ID: id, Score: score, Payload: map[string]interface{}{"origin": origin}, Vector: vector}
+}
+
+func hitIDs(hits []SearchHit) []interface{} {
+	ids := []interface{}{}
+	for _, hit := range hits {
+		ids = append(ids, hit.ID)
+	}
+	return ids
+}
+
+func TestSelectMMR(t *testing.T) {
+	candidates := []SearchHit{
+		mmrHit("a", 0.90, "x", 1, 0),
+		mmrHit("b", 0.89, "x", 2, 0), // Same direction as a
+		mmrHit("c", 0.70, "y", 0, 1),
+		mmrHit("d", 0.65, "z", 1, 1),
+	}
+	tests := []struct {
+		name         string
+		limit        int
+		lambda       float64
+		maxPerOrigin int
+		want         []interface{}
+	}{
+		{"relevance only", 4, 1, 0, []interface{}{"a", "b", "c", "d"}},
+		{"diversity pushes the near copy down", 3, 0.5, 0, []interface{}{"a", "c", "d"}},
+		{"near copy still fills the list", 4, 0.5, 0, []interface{}{"a", "c", "d", "b"}},
+		{"per origin cap", 4, 1, 1, []interface{}{"a", "c", "d"}},
+		{"limit", 1, 0.7, 0, []interface{}{"a"}},
+		{"zero limit", 0, 0.7, 0, []interface{}{}},
+	}
+	for _, test := range tests {
+		if got := hitIDs(SelectMMR(candidates, test.limit, test.lambda, test.maxPerOrigin)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: SelectMMR = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestCapPerOrigin(t *testing.T) {
+	hits := []SearchHit{
+		mmrHit("a", 0.9, "x"),
+		mmrHit("b", 0.8, "x"),
+		mmrHit("c", 0.7, "y"),
+		mmrHit("d", 0.6, "x"),
+		mmrHit("e", 0.5, "z"),
+	}
+	tests := []struct {
+		limit, maxPerOrigin int
+		want                []interface{}
+	}{
+		{5, 1, []interface{}{"a", "c", "e"}},
+		{5, 2, []interface{}{"a", "b", "c", "e"}},
+		{2, 1, []interface{}{"a", "c"}},
+		{5, 5, []interface{}{"a", "b", "c", "d", "e"}},
+	}
+	for _, test := range tests {
+		if got := hitIDs(CapPerOrigin(hits, test.limit, test.maxPerOrigin)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("CapPerOrigin(limit %d, max %d) = %v, want %v", test.limit, test.maxPerOrigin, got, test.want)
+		}
+	}
+}
@@ -6,6 +6,11 @@ type Chunk struct {
 	Text       string                 `json:"text"`
 	Origin     string                 `json:"origin"`
 	LineNumber int                    `json:"line_number"`
+	LineStart  int                    `json:"line_start"` // Source lines spanned by the sentence
+	LineEnd    int                    `json:"line_end"`
+	ChunkIndex int                    `json:"chunk_index"` // Position of the chunk within its document
+	DocumentID string                 `json:"document_id"` // Shared by all chunks from one /chunk call
+	Sentence   string                 `json:"sentence"`    // Sentence without the neighbour overlap
 	Timestamp  time.Time              `json:"timestamp"`
 	Tags       []string               `json:"tags"`
 	Metadata   map[string]interface{} `json:"metadata"`
@@ -16,3 +21,39 @@ type ChunkRequest struct {
 	Origin string `json:"origin"`
 	Text   string `json:"text"`
 }
+
+type SearchHit struct {
+	ID         interface{}            `json:"id"`
+	Version    int                    `json:"version"`
+	Score      float64                `json:"score"`
+	Payload    map[string]interface{} `json:"payload"`
+	Vector     []float32              `json:"vector,omitempty"`
+	Collection string                 `json:"collection,omitempty"` // Collection the hit came from
+	Passage    *Passage               `json:"passage,omitempty"`
+}
+
+type Passage struct {
+	Text       string        `json:"text"`
+	StartIndex int           `json:"start_index"`
+	EndIndex   int           `json:"end_index"`
+	LineStart  int           `json:"line_start,omitempty"`
+	LineEnd    int           `json:"line_end,omitempty"`
+	PointIDs   []interface{} `json:"point_ids"`
+}
+
+// ChunkOptions sizes chunks in tokens of the embedding model.
+type ChunkOptions struct {
+	Model        string        // Embedding model whose tokenizer and input limit apply
+	TargetTokens int           // Sentences are grouped up to this size; 0 keeps one sentence per chunk
+	Redaction    RedactOptions // PII handling, applied to sentences before they are cut or overlapped
+}
+
+type LookupOptions struct {
+	Limit        int     // Number of results to return
+	MMR          bool    // Re-rank candidates with maximal marginal relevance
+	Lambda       float64 // MMR trade-off: 1 = pure relevance, 0 = pure diversity
+	MaxPerOrigin int     // Max results per origin (0 = unlimited)
+	Expand       int     // Neighbouring chunks to include on each side of a hit
+	Expansion    string  // Query expansion mode: "", "multi" or "hyde"
+	NumQueries   int     // Paraphrases generated in "multi" mode
+}
@@ -2,36 +2,59 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"sort"
 	"time"
 
 	"github.com/google/uuid"
 )
 
-func SendChunkToQdrant(chunk Chunk, collection string) error {
+const qdrantBaseURL = "http://192.168.178.136:30333"
+
+// Qdrant writes are keyed by point id and reads have no side effects, so both can be resent.
+var qdrantPolicy = RetryPolicy{Timeout: 30 * time.Second, Idempotent: true}
+
+func qdrantGet(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return DoUpstream(req, qdrantPolicy)
+}
+
+func SendChunkToQdrant(ctx context.Context, chunk Chunk, collection string) error {
 	if len(chunk.Vector) == 0 {
 		return fmt.Errorf("chunk vector is empty")
 	}
 
-	if collection == "" {
-		collection = "Memory"
-	}
+	collection = registry.Resolve(collection)
 
-	url := fmt.Sprintf("http://192.168.178.136:30333/collections/%s/points", collection)
+	url := fmt.Sprintf("%s/collections/%s/points", qdrantBaseURL, collection)
 
 	point := map[string]interface{}{
 		"id":     uuid.New().String(),
-		"vector": chunk.Vector,
+		"vector": qdrantPointVector(ctx, collection, chunk.Vector),
 		"payload": map[string]interface{}{
-			"text":      chunk.Text,
-			"origin":    chunk.Origin,
-			"timestamp": chunk.Timestamp.Format(time.RFC3339),
-			"tags":      chunk.Tags,
-			"metadata":  chunk.Metadata,
+			"text":        chunk.Text,
+			"origin":      chunk.Origin,
+			"timestamp":   chunk.Timestamp.Format(time.RFC3339),
+			"tags":        chunk.Tags,
+			"metadata":    chunk.Metadata,
+			"line_start":  chunk.LineStart,
+			"line_end":    chunk.LineEnd,
+			"chunk_index": chunk.ChunkIndex,
+			"document_id": chunk.DocumentID,
+			"sentence":    chunk.Sentence,
 		},
 	}
+	if tenant := TenantFrom(ctx); tenant != "" {
+		point["payload"].(map[string]interface{})[tenantField] = tenant
+	}
 
 	payload := map[string]interface{}{
 		"points": []interface{}{point},
@@ -42,14 +65,13 @@ func SendChunkToQdrant(chunk Chunk, collection string) error {
 		return fmt.Errorf("failed to marshal payload: %w", err)
 	}
 
-	req, err := http.NewRequest("PUT", url, bytes.NewBuffer(body))
+	req, err := http.NewRequestWithContext(ctx, "PUT", url, bytes.NewBuffer(body))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := DoUpstream(req, qdrantPolicy)
 	if err != nil {
 		return fmt.Errorf("failed to send request: %w", err)
 	}
@@ -62,26 +84,22 @@ func SendChunkToQdrant(chunk Chunk, collection string) error {
 	return nil
 }
 
-func DeletePointFromQdrant(pointID string, collection string) error {
-	url := fmt.Sprintf("http://192.168.178.136:30333/collections/%s/points/delete", collection)
-
-	bodyData := map[string]interface{}{
-		"points": []string{pointID},
-	}
+func DeletePointFromQdrant(ctx context.Context, pointID string, collection string) error {
+	url := fmt.Sprintf("%s/collections/%s/points/delete", qdrantBaseURL, collection)
 
-	body, err := json.Marshal(bodyData)
+	// A tenant's delete matches nothing outside its own points.
+	body, err := json.Marshal(pointsSelector(ctx, []interface{}{pointID}))
 	if err != nil {
 		return fmt.Errorf("failed to marshal delete payload: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(body))
 	if err != nil {
 		return fmt.Errorf("failed to create delete request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := DoUpstream(req, qdrantPolicy)
 	if err != nil {
 		return fmt.Errorf("failed to send delete request: %w", err)
 	}
@@ -93,3 +111,753 @@ func DeletePointFromQdrant(pointID string, collection string) error {
 
 	return nil
 }
+
+// SetQdrantPayload overwrites the given payload keys of one point, leaving the others untouched.
+func SetQdrantPayload(ctx context.Context, collection string, pointID interface{}, payload map[string]interface{}) error {
+	url := fmt.Sprintf("%s/collections/%s/points/payload?wait=true", qdrantBaseURL, collection)
+
+	selector := pointsSelector(ctx, []interface{}{pointID})
+	selector["payload"] = payload
+	body, err := json.Marshal(selector)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload update: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(body))
+	if err != nil {
+		return fmt.Errorf("failed to create payload request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := DoUpstream(req, qdrantPolicy)
+	if err != nil {
+		return fmt.Errorf("failed to send payload request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("qdrant set payload failed: %s: %s", resp.Status, string(respBody))
+	}
+
+	return nil
+}
+
+// ScrollQdrant pages through every point matching filter, handing each page to handle.
+// payloadFields limits the returned payload to those keys, nil returns all of it.
+func ScrollQdrant(ctx context.Context, collection string, filter map[string]interface{}, payloadFields []string, withVector bool, handle func([]SearchHit) error) error {
+	url := fmt.Sprintf("%s/collections/%s/points/scroll", qdrantBaseURL, collection)
+	filter = tenantFilter(ctx, filter)
+
+	var offset interface{}
+	for {
+		bodyData := map[string]interface{}{
+			"limit":        256,
+			"with_payload": true,
+			"with_vector":  qdrantWithVector(ctx, collection, withVector),
+		}
+		if payloadFields != nil {
+			bodyData["with_payload"] = map[string]interface{}{"include": payloadFields}
+		}
+		if filter != nil {
+			bodyData["filter"] = filter
+		}
+		if offset != nil {
+			bodyData["offset"] = offset
+		}
+
+		body, err := json.Marshal(bodyData)
+		if err != nil {
+			return fmt.Errorf("failed to marshal scroll payload: %w", err)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(body))
+		if err != nil {
+			return fmt.Errorf("failed to create scroll request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := DoUpstream(req, qdrantPolicy)
+		if err != nil {
+			return fmt.Errorf("failed to send scroll request: %w", err)
+		}
+
+		var response struct {
+			Result struct {
+				Points         []qdrantPoint `json:"points"`
+				NextPageOffset interface{}   `json:"next_page_offset"`
+			} `json:"result"`
+		}
+		if resp.StatusCode >= 300 {
+			resp.Body.Close()
+			return fmt.Errorf("qdrant scroll failed: %s", resp.Status)
+		}
+		err = json.NewDecoder(resp.Body).Decode(&response)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("failed to decode scroll response: %w", err)
+		}
+
+		if len(response.Result.Points) > 0 {
+			points, err := decodeHits(ctx, collection, response.Result.Points)
+			if err != nil {
+				return fmt.Errorf("failed to decode scroll response: %w", err)
+			}
+			if err := handle(points); err != nil {
+				return err
+			}
+		}
+
+		if response.Result.NextPageOffset == nil {
+			return nil
+		}
+		offset = response.Result.NextPageOffset
+	}
+}
+
+var ErrCollectionExists = errors.New("collection already exists")
+
+var validDistances = map[string]bool{"Cosine": true, "Dot": true, "Euclid": true, "Manhattan": true}
+var validCompressions = map[string]bool{"x4": true, "x8": true, "x16": true, "x32": true, "x64": true}
+
+// CollectionConfig holds the tunable settings of a new collection.
+type CollectionConfig struct {
+	Size         int                 `json:"size,omitempty"`     // Defaults to the embedding model's dimension
+	Distance     string              `json:"distance,omitempty"` // Cosine, Dot, Euclid or Manhattan
+	OnDisk       bool                `json:"on_disk,omitempty"`  // Keep vectors on disk instead of RAM
+	HNSW         *HNSWConfig         `json:"hnsw,omitempty"`
+	Quantization *QuantizationConfig `json:"quantization,omitempty"`
+	Vectors      []NamedVectorConfig `json:"vectors,omitempty"` // Named vectors, Chisel embeds into the alphabetically first
+}
+
+type HNSWConfig struct {
+	M           int  `json:"m,omitempty"`
+	EfConstruct int  `json:"ef_construct,omitempty"`
+	OnDisk      bool `json:"on_disk,omitempty"`
+}
+
+type QuantizationConfig struct {
+	Type        string  `json:"type"`                  // "scalar" or "product"
+	Quantile    float64 `json:"quantile,omitempty"`    // Scalar only
+	Compression string  `json:"compression,omitempty"` // Product only: x4, x8, x16, x32 or x64
+	AlwaysRAM   bool    `json:"always_ram,omitempty"`
+}
+
+type NamedVectorConfig struct {
+	Name     string `json:"name"`
+	Size     int    `json:"size,omitempty"`
+	Distance string `json:"distance,omitempty"`
+	OnDisk   bool   `json:"on_disk,omitempty"`
+}
+
+// Prepare fills in defaults from the embedding dimension and validates the config.
+func (c *CollectionConfig) Prepare(dimension int) error {
+	if c.Distance == "" {
+		c.Distance = "Cosine"
+	}
+	if !validDistances[c.Distance] {
+		return fmt.Errorf("unsupported distance %q", c.Distance)
+	}
+	if c.Size == 0 {
+		c.Size = dimension
+	}
+	if c.Size != dimension {
+		return fmt.Errorf("size %d does not match the embedding dimension %d", c.Size, dimension)
+	}
+
+	seen := map[string]bool{}
+	embedded := c.VectorName()
+	for i := range c.Vectors {
+		vector := &c.Vectors[i]
+		if vector.Name == "" || seen[vector.Name] {
+			return fmt.Errorf("named vectors need unique, non-empty names")
+		}
+		seen[vector.Name] = true
+		if vector.Distance == "" {
+			vector.Distance = c.Distance
+		}
+		if !validDistances[vector.Distance] {
+			return fmt.Errorf("unsupported distance %q for vector %s", vector.Distance, vector.Name)
+		}
+		if vector.Size == 0 {
+			vector.Size = dimension
+		}
+		if vector.Name == embedded && vector.Size != dimension {
+			return fmt.Errorf("vector %s size %d does not match the embedding dimension %d", vector.Name, vector.Size, dimension)
+		}
+	}
+
+	if c.HNSW != nil && (c.HNSW.M < 0 || c.HNSW.EfConstruct < 0) {
+		return fmt.Errorf("hnsw 'm' and 'ef_construct' must be positive")
+	}
+
+	if q := c.Quantization; q != nil {
+		switch q.Type {
+		case "scalar":
+			if q.Quantile < 0 || q.Quantile > 1 {
+				return fmt.Errorf("scalar quantization quantile must be between 0 and 1")
+			}
+		case "product":
+			if q.Compression == "" {
+				q.Compression = "x16"
+			}
+			if !validCompressions[q.Compression] {
+				return fmt.Errorf("unsupported product quantization compression %q", q.Compression)
+			}
+		default:
+			return fmt.Errorf("quantization type must be \"scalar\" or \"product\"")
+		}
+	}
+
+	return nil
+}
+
+// VectorName returns the name Chisel stores embeddings under, empty for an unnamed vector.
+// It is the alphabetically first name, the same rule GetQdrantCollectionConfig applies
+// to collections found in Qdrant, so both agree after the registry is lost.
+func (c CollectionConfig) VectorName() string {
+	names := make([]string, 0, len(c.Vectors))
+	for _, vector := range c.Vectors {
+		names = append(names, vector.Name)
+	}
+	return firstVectorName(names)
+}
+
+// EmbeddedDistance returns the distance of the vector VectorName selects: its own
+// when named, the collection's otherwise. Call after Prepare.
+func (c CollectionConfig) EmbeddedDistance() string {
+	embedded := c.VectorName()
+	for _, vector := range c.Vectors {
+		if vector.Name == embedded {
+			return vector.Distance
+		}
+	}
+	return c.Distance
+}
+
+func firstVectorName(names []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+	return names[0]
+}
+
+// collectionMetadata is stored with each collection Chisel creates, so the embedding
+// model survives the loss of the local registry file.
+type collectionMetadata struct {
+	EmbeddingModel string    `json:"chisel_embedding_model,omitempty"`
+	CreatedAt      time.Time `json:"chisel_created_at,omitempty"`
+}
+
+// qdrantBody renders the config as a Qdrant create collection request.
+func (c CollectionConfig) qdrantBody() map[string]interface{} {
+	var vectors interface{} = map[string]interface{}{
+		"size":     c.Size,
+		"distance": c.Distance,
+		"on_disk":  c.OnDisk,
+	}
+	if len(c.Vectors) > 0 {
+		named := map[string]interface{}{}
+		for _, vector := range c.Vectors {
+			named[vector.Name] = map[string]interface{}{
+				"size":     vector.Size,
+				"distance": vector.Distance,
+				"on_disk":  vector.OnDisk || c.OnDisk,
+			}
+		}
+		vectors = named
+	}
+
+	body := map[string]interface{}{
+		"vectors": vectors,
+	}
+	if c.OnDisk {
+		body["on_disk_payload"] = true
+	}
+
+	if c.HNSW != nil {
+		hnsw := map[string]interface{}{"on_disk": c.HNSW.OnDisk}
+		if c.HNSW.M > 0 {
+			hnsw["m"] = c.HNSW.M
+		}
+		if c.HNSW.EfConstruct > 0 {
+			hnsw["ef_construct"] = c.HNSW.EfConstruct
+		}
+		body["hnsw_config"] = hnsw
+	}
+
+	if q := c.Quantization; q != nil {
+		switch q.Type {
+		case "scalar":
+			scalar := map[string]interface{}{"type": "int8", "always_ram": q.AlwaysRAM}
+			if q.Quantile > 0 {
+				scalar["quantile"] = q.Quantile
+			}
+			body["quantization_config"] = map[string]interface{}{"scalar": scalar}
+		case "product":
+			body["quantization_config"] = map[string]interface{}{
+				"product": map[string]interface{}{
+					"compression": q.Compression,
+					"always_ram":  q.AlwaysRAM,
+				},
+			}
+		}
+	}
+
+	return body
+}
+
+// CreateQdrantCollection creates a collection from a prepared config, recording metadata with it.
+func CreateQdrantCollection(ctx context.Context, name string, config CollectionConfig, metadata collectionMetadata) error {
+	url := fmt.Sprintf("%s/collections/%s", qdrantBaseURL, name)
+
+	payload := config.qdrantBody()
+	payload["metadata"] = metadata
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal collection payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "PUT", url, bytes.NewBuffer(body))
+	if err != nil {
+		return fmt.Errorf("failed to create collection request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Not resent after a lost response: the retry would fail with a conflict.
+	resp, err := DoUpstream(req, RetryPolicy{Timeout: qdrantPolicy.Timeout})
+	if err != nil {
+		return fmt.Errorf("failed to send collection request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusConflict {
+		return fmt.Errorf("%w: %s", ErrCollectionExists, name)
+	}
+	if resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("qdrant create collection failed: %s: %s", resp.Status, string(respBody))
+	}
+
+	return nil
+}
+
+// qdrantPointVector shapes a vector for upserts, keyed by name when the collection uses named vectors.
+func qdrantPointVector(ctx context.Context, collection string, vector []float32) interface{} {
+	if info, err := registry.Get(ctx, collection); err == nil && info.VectorName != "" {
+		return map[string][]float32{info.VectorName: vector}
+	}
+	return vector
+}
+
+// qdrantSearchVector shapes a query vector for searches against named vectors.
+func qdrantSearchVector(ctx context.Context, collection string, vector []float32) interface{} {
+	if info, err := registry.Get(ctx, collection); err == nil && info.VectorName != "" {
+		return map[string]interface{}{"name": info.VectorName, "vector": vector}
+	}
+	return vector
+}
+
+// qdrantWithVector asks only for the vector Chisel embeds into, since Qdrant
+// returns every named vector of a point for with_vector: true.
+func qdrantWithVector(ctx context.Context, collection string, withVector bool) interface{} {
+	if !withVector {
+		return false
+	}
+	if info, err := registry.Get(ctx, collection); err == nil && info.VectorName != "" {
+		return []string{info.VectorName}
+	}
+	return true
+}
+
+// qdrantPoint is a search or scroll result whose vector is still in Qdrant's shape.
+type qdrantPoint struct {
+	SearchHit
+	Vector json.RawMessage `json:"vector"`
+}
+
+// decodeHits picks each point's vector out of a plain vector or the collection's named vector.
+func decodeHits(ctx context.Context, collection string, points []qdrantPoint) ([]SearchHit, error) {
+	vectorName := ""
+	if info, err := registry.Get(ctx, collection); err == nil {
+		vectorName = info.VectorName
+	}
+
+	hits := make([]SearchHit, len(points))
+	for i, point := range points {
+		hits[i] = point.SearchHit
+		if len(point.Vector) == 0 || string(point.Vector) == "null" {
+			continue
+		}
+		if vectorName == "" {
+			if err := json.Unmarshal(point.Vector, &hits[i].Vector); err != nil {
+				return nil, fmt.Errorf("point %v: %w", point.ID, err)
+			}
+			continue
+		}
+		var named map[string][]float32
+		if err := json.Unmarshal(point.Vector, &named); err != nil {
+			return nil, fmt.Errorf("point %v: %w", point.ID, err)
+		}
+		hits[i].Vector = named[vectorName]
+	}
+	return hits, nil
+}
+
+// GetQdrantCollectionConfig describes an existing collection from its Qdrant config: the
+// vector size and distance and, for named vectors, the alphabetically first vector
+// name. The embedding model is read from the metadata Chisel stores at creation and
+// left empty for collections created elsewhere.
+func GetQdrantCollectionConfig(ctx context.Context, name string) (CollectionInfo, error) {
+	url := fmt.Sprintf("%s/collections/%s", qdrantBaseURL, name)
+
+	resp, err := qdrantGet(ctx, url)
+	if err != nil {
+		return CollectionInfo{}, fmt.Errorf("failed to fetch collection: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return CollectionInfo{}, fmt.Errorf("%w: %s", ErrCollectionNotFound, name)
+	}
+	if resp.StatusCode >= 300 {
+		return CollectionInfo{}, fmt.Errorf("qdrant get collection failed: %s", resp.Status)
+	}
+
+	var response struct {
+		Result struct {
+			Config struct {
+				Params struct {
+					Vectors json.RawMessage `json:"vectors"`
+				} `json:"params"`
+				Metadata collectionMetadata `json:"metadata"`
+			} `json:"config"`
+		} `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return CollectionInfo{}, fmt.Errorf("failed to decode collection info: %w", err)
+	}
+
+	type vectorParams struct {
+		Size     int    `json:"size"`
+		Distance string `json:"distance"`
+	}
+	info := CollectionInfo{
+		Name:           name,
+		EmbeddingModel: response.Result.Config.Metadata.EmbeddingModel,
+		CreatedAt:      response.Result.Config.Metadata.CreatedAt,
+	}
+
+	var single vectorParams
+	if err := json.Unmarshal(response.Result.Config.Params.Vectors, &single); err == nil && single.Size > 0 {
+		info.Dimension, info.Distance = single.Size, single.Distance
+		return info, nil
+	}
+
+	var named map[string]vectorParams
+	if err := json.Unmarshal(response.Result.Config.Params.Vectors, &named); err == nil && len(named) > 0 {
+		names := make([]string, 0, len(named))
+		for vectorName := range named {
+			names = append(names, vectorName)
+		}
+		info.VectorName = firstVectorName(names)
+		info.Dimension, info.Distance = named[info.VectorName].Size, named[info.VectorName].Distance
+		return info, nil
+	}
+
+	return CollectionInfo{}, fmt.Errorf("collection %s has no vector config", name)
+}
+
+// ListQdrantCollections returns the names of all collections in Qdrant.
+func ListQdrantCollections(ctx context.Context) ([]string, error) {
+	resp, err := qdrantGet(ctx, qdrantBaseURL+"/collections")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list collections: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("qdrant list collections failed: %s", resp.Status)
+	}
+
+	var response struct {
+		Result struct {
+			Collections []struct {
+				Name string `json:"name"`
+			} `json:"collections"`
+		} `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode collections: %w", err)
+	}
+
+	names := make([]string, 0, len(response.Result.Collections))
+	for _, collection := range response.Result.Collections {
+		names = append(names, collection.Name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// GetQdrantCollectionInfo returns Qdrant's raw description of a collection.
+func GetQdrantCollectionInfo(ctx context.Context, name string) (map[string]interface{}, error) {
+	resp, err := qdrantGet(ctx, fmt.Sprintf("%s/collections/%s", qdrantBaseURL, name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch collection: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrCollectionNotFound, name)
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("qdrant get collection failed: %s", resp.Status)
+	}
+
+	var response struct {
+		Result map[string]interface{} `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode collection info: %w", err)
+	}
+	return response.Result, nil
+}
+
+// Payload indexes created for every Chisel collection.
+var standardPayloadIndexes = map[string]string{
+	"origin":      "keyword",
+	"origins":     "keyword",
+	"tags":        "keyword",
+	"subject":     "keyword",
+	"document_id": "keyword",
+	"chunk_index": "integer",
+	"timestamp":   "datetime",
+
+	"metadata.language": "keyword",
+	tenantField:         "keyword",
+}
+
+var validIndexSchemas = map[string]bool{
+	"keyword": true, "integer": true, "float": true, "bool": true,
+	"geo": true, "datetime": true, "text": true, "uuid": true,
+}
+
+// CreatePayloadIndex indexes a payload field so filters on it stay fast.
+func CreatePayloadIndex(ctx context.Context, collection, field, schema string) error {
+	if !validIndexSchemas[schema] {
+		return fmt.Errorf("unsupported index schema %q", schema)
+	}
+
+	url := fmt.Sprintf("%s/collections/%s/index?wait=true", qdrantBaseURL, collection)
+
+	body, err := json.Marshal(map[string]interface{}{
+		"field_name":   field,
+		"field_schema": schema,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal index payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "PUT", url, bytes.NewBuffer(body))
+	if err != nil {
+		return fmt.Errorf("failed to create index request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := DoUpstream(req, qdrantPolicy)
+	if err != nil {
+		return fmt.Errorf("failed to send index request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %s", ErrCollectionNotFound, collection)
+	}
+	if resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("qdrant create index failed: %s: %s", resp.Status, string(respBody))
+	}
+
+	return nil
+}
+
+// CreateStandardIndexes indexes the payload fields Chisel itself filters on.
+func CreateStandardIndexes(ctx context.Context, collection string) error {
+	fields := make([]string, 0, len(standardPayloadIndexes))
+	for field := range standardPayloadIndexes {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		if err := CreatePayloadIndex(ctx, collection, field, standardPayloadIndexes[field]); err != nil {
+			return fmt.Errorf("index %s: %w", field, err)
+		}
+	}
+	return nil
+}
+
+// UpsertQdrantPoints writes a batch of points, each with id, vector and payload.
+func UpsertQdrantPoints(ctx context.Context, collection string, points []map[string]interface{}) error {
+	if err := claimTenantPoints(ctx, collection, points); err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/collections/%s/points?wait=true", qdrantBaseURL, collection)
+
+	body, err := json.Marshal(map[string]interface{}{"points": points})
+	if err != nil {
+		return fmt.Errorf("failed to marshal points: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "PUT", url, bytes.NewBuffer(body))
+	if err != nil {
+		return fmt.Errorf("failed to create upsert request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := DoUpstream(req, qdrantPolicy)
+	if err != nil {
+		return fmt.Errorf("failed to send upsert request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("qdrant upsert failed: %s: %s", resp.Status, string(respBody))
+	}
+
+	return nil
+}
+
+// CountQdrantPoints returns the exact number of points in a collection matching
+// filter, limited to the context tenant's points. A nil filter counts them all.
+func CountQdrantPoints(ctx context.Context, collection string, filter map[string]interface{}) (int, error) {
+	url := fmt.Sprintf("%s/collections/%s/points/count", qdrantBaseURL, collection)
+
+	bodyData := map[string]interface{}{"exact": true}
+	if filter := tenantFilter(ctx, filter); filter != nil {
+		bodyData["filter"] = filter
+	}
+	body, err := json.Marshal(bodyData)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal count payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create count request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := DoUpstream(req, qdrantPolicy)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count points: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return 0, fmt.Errorf("%w: %s", ErrCollectionNotFound, collection)
+	}
+	if resp.StatusCode >= 300 {
+		return 0, fmt.Errorf("qdrant count failed: %s", resp.Status)
+	}
+
+	var response struct {
+		Result struct {
+			Count int `json:"count"`
+		} `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return 0, fmt.Errorf("failed to decode count response: %w", err)
+	}
+	return response.Result.Count, nil
+}
+
+// SwapQdrantAlias points alias at collection in a single atomic operation,
+// replacing whatever the alias pointed at before.
+func SwapQdrantAlias(ctx context.Context, alias, collection string) error {
+	aliases, err := ListQdrantAliases(ctx)
+	if err != nil {
+		return err
+	}
+
+	actions := []map[string]interface{}{}
+	if _, exists := aliases[alias]; exists {
+		actions = append(actions, map[string]interface{}{
+			"delete_alias": map[string]string{"alias_name": alias},
+		})
+	}
+	actions = append(actions, map[string]interface{}{
+		"create_alias": map[string]string{"collection_name": collection, "alias_name": alias},
+	})
+
+	return updateQdrantAliases(ctx, actions)
+}
+
+// DeleteQdrantAlias removes an alias, leaving its collection untouched.
+func DeleteQdrantAlias(ctx context.Context, alias string) error {
+	return updateQdrantAliases(ctx, []map[string]interface{}{
+		{"delete_alias": map[string]string{"alias_name": alias}},
+	})
+}
+
+func updateQdrantAliases(ctx context.Context, actions []map[string]interface{}) error {
+	url := fmt.Sprintf("%s/collections/aliases", qdrantBaseURL)
+
+	body, err := json.Marshal(map[string]interface{}{"actions": actions})
+	if err != nil {
+		return fmt.Errorf("failed to marshal alias payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(body))
+	if err != nil {
+		return fmt.Errorf("failed to create alias request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := DoUpstream(req, qdrantPolicy)
+	if err != nil {
+		return fmt.Errorf("failed to send alias request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("qdrant alias update failed: %s: %s", resp.Status, string(respBody))
+	}
+
+	return nil
+}
+
+// ListQdrantAliases returns every alias mapped to the collection it points at.
+func ListQdrantAliases(ctx context.Context) (map[string]string, error) {
+	resp, err := qdrantGet(ctx, qdrantBaseURL+"/aliases")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list aliases: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("qdrant list aliases failed: %s", resp.Status)
+	}
+
+	var response struct {
+		Result struct {
+			Aliases []struct {
+				AliasName      string `json:"alias_name"`
+				CollectionName string `json:"collection_name"`
+			} `json:"aliases"`
+		} `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode aliases: %w", err)
+	}
+
+	aliases := map[string]string{}
+	for _, alias := range response.Result.Aliases {
+		aliases[alias.AliasName] = alias.CollectionName
+	}
+	return aliases, nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import "testing"
+
+func TestPrepareChecksTheEmbeddedVector(t *testing.T) {
+	tests := []struct {
+		name    string
+		vectors []NamedVectorConfig
+		valid   bool
+	}{
+		{"embedded vector too small", []NamedVectorConfig{{Name: "z"}, {Name: "a", Size: 384}}, false},
+		{"other vector may differ", []NamedVectorConfig{{Name: "z", Size: 384}, {Name: "a"}}, true},
+		{"embedded vector fits", []NamedVectorConfig{{Name: "z"}, {Name: "a", Size: 1536}}, true},
+		{"duplicate names", []NamedVectorConfig{{Name: "a"}, {Name: "a"}}, false},
+	}
+	for _, test := range tests {
+		config := CollectionConfig{Vectors: test.vectors}
+		if err := config.Prepare(1536); (err == nil) != test.valid {
+			t.Errorf("%s: Prepare err = %v, want valid %v", test.name, err, test.valid)
+		}
+	}
+}
+
+func TestEmbeddedDistance(t *testing.T) {
+	tests := []struct {
+		name   string
+		config CollectionConfig
+		want   string
+	}{
+		{"unnamed", CollectionConfig{Distance: "Dot"}, "Dot"},
+		{"unnamed default", CollectionConfig{}, "Cosine"},
+		{"named with own distance", CollectionConfig{Vectors: []NamedVectorConfig{{Name: "a", Distance: "Euclid"}}}, "Euclid"},
+		{"named inherits", CollectionConfig{Distance: "Manhattan", Vectors: []NamedVectorConfig{{Name: "a"}}}, "Manhattan"},
+		{"alphabetically first wins", CollectionConfig{Vectors: []NamedVectorConfig{{Name: "z", Distance: "Dot"}, {Name: "a", Distance: "Euclid"}}}, "Euclid"},
+	}
+	for _, test := range tests {
+		if err := test.config.Prepare(1536); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if got := test.config.EmbeddedDistance(); got != test.want {
+			t.Errorf("%s: EmbeddedDistance = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
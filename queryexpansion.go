@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const defaultExpansionQueries = 3
+const maxExpansionQueries = 8
+const rrfK = 60 // Reciprocal rank fusion damping constant
+
+var multiQueryPrompt = `You rewrite search queries for a semantic search engine.
+Given a query, write %d alternative phrasings that keep its meaning but vary wording and detail.
+Output only the rewritten queries, one per line, without numbering.`
+
+var hydePrompt = `You write short passages for a semantic search engine.
+Given a query, write a single factual-sounding paragraph (3-5 sentences) that would answer it,
+as if taken from a reference document. Output only the paragraph.`
+
+// ExpandQuery turns a query into the texts that get embedded for search.
+// "multi" returns the query plus LLM paraphrases, "hyde" returns a hypothetical answer passage.
+func ExpandQuery(ctx context.Context, query string, mode string, n int) ([]string, error) {
+	switch mode {
+	case "":
+		return []string{query}, nil
+	case "multi":
+		if n <= 0 {
+			n = defaultExpansionQueries
+		}
+		output, err := ChatCompletion(ctx, groqProvider, []ChatMessage{
+			{Role: "system", Content: fmt.Sprintf(multiQueryPrompt, n)},
+			{Role: "user", Content: query},
+		}, 0.7, 512)
+		if err != nil {
+			return nil, fmt.Errorf("query expansion failed: %w", err)
+		}
+
+		queries := []string{query}
+		for _, line := range strings.Split(output, "\n") {
+			line = strings.TrimSpace(prefixRegex.ReplaceAllString(strings.TrimSpace(line), ""))
+			line = strings.TrimLeft(line, "-* ")
+			if line == "" || strings.EqualFold(line, query) {
+				continue
+			}
+			queries = append(queries, line)
+			if len(queries) > n {
+				break
+			}
+		}
+		return queries, nil
+	case "hyde":
+		passage, err := ChatCompletion(ctx, groqProvider, []ChatMessage{
+			{Role: "system", Content: hydePrompt},
+			{Role: "user", Content: query},
+		}, 0.5, 512)
+		if err != nil {
+			return nil, fmt.Errorf("hypothetical document generation failed: %w", err)
+		}
+		if passage == "" {
+			return []string{query}, nil
+		}
+		return []string{passage}, nil
+	}
+
+	return nil, fmt.Errorf("unknown expansion mode %q", mode)
+}
+
+// FuseRankings merges several ranked hit lists with reciprocal rank fusion.
+// Scores are rescaled so the best fused hit scores 1.
+func FuseRankings(rankings [][]SearchHit) []SearchHit {
+	if len(rankings) == 1 {
+		return rankings[0]
+	}
+
+	fused := map[string]*SearchHit{}
+	scores := map[string]float64{}
+	var order []string
+
+	for _, ranking := range rankings {
+		for rank, hit := range ranking {
+			key := fmt.Sprint(hit.ID)
+			if _, ok := fused[key]; !ok {
+				hitCopy := hit
+				fused[key] = &hitCopy
+				order = append(order, key)
+			}
+			scores[key] += 1.0 / float64(rrfK+rank+1)
+		}
+	}
+
+	var best float64
+	for _, score := range scores {
+		if score > best {
+			best = score
+		}
+	}
+
+	result := make([]SearchHit, 0, len(order))
+	for _, key := range order {
+		hit := *fused[key]
+		hit.Score = scores[key] / best
+		result = append(result, hit)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Score > result[j].Score
+	})
+
+	return result
+}
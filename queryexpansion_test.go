@@ -0,0 +1,46 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFuseRankings(t *testing.T) {
+	single := []SearchHit{{ID: "a", Score: 0.4}, {ID: "b", Score: 0.2}}
+	if got := FuseRankings([][]SearchHit{single}); got[0].Score != 0.4 || got[1].Score != 0.2 {
+		t.Errorf("a single ranking must keep its scores, got %v", got)
+	}
+
+	rankings := [][]SearchHit{
+		{{ID: "a"}, {ID: "b"}, {ID: "c"}},
+		{{ID: "b"}, {ID: "a"}},
+		{{ID: "b"}, {ID: "d"}},
+	}
+	rrf := func(ranks ...int) float64 {
+		var sum float64
+		for _, rank := range ranks {
+			sum += 1.0 / float64(rrfK+rank)
+		}
+		return sum
+	}
+	best := rrf(2, 1, 1)
+	want := []struct {
+		id    string
+		score float64
+	}{
+		{"b", 1},
+		{"a", rrf(1, 2) / best},
+		{"d", rrf(2) / best},
+		{"c", rrf(3) / best},
+	}
+
+	fused := FuseRankings(rankings)
+	if len(fused) != len(want) {
+		t.Fatalf("got %d hits, want %d", len(fused), len(want))
+	}
+	for i, w := range want {
+		if fused[i].ID != w.id || math.Abs(fused[i].Score-w.score) > 1e-12 {
+			t.Errorf("hit %d = %v %.6f, want %s %.6f", i, fused[i].ID, fused[i].Score, w.id, w.score)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const maxRateLimitRetries = 3
+
+// Default tokens-per-minute budget per upstream host, overridable via <NAME>_TPM.
+var defaultTPM = map[string]struct {
+	env   string
+	limit int
+}{
+	"api.groq.com":   {env: "GROQ_TPM", limit: 6000}, // Free tier
+	"api.openai.com": {env: "OPENAI_TPM", limit: 1000000},
+}
+
+// TokenBucket is a process-wide tokens-per-minute budget for one upstream.
+// Callers reserve an estimate up front and settle it with the real usage once known.
+type TokenBucket struct {
+	mu           sync.Mutex
+	name         string
+	capacity     float64 // 0 means unlimited, only server hints are honoured
+	tokens       float64
+	perSecond    float64
+	last         time.Time
+	blockedUntil time.Time // Set from Retry-After and x-ratelimit-reset-* headers
+}
+
+// Reservation is a claim on a bucket that gets corrected once actual usage is known.
+type Reservation struct {
+	bucket *TokenBucket
+	tokens int
+}
+
+var rateLimiters = struct {
+	sync.Mutex
+	buckets map[string]*TokenBucket
+}{buckets: map[string]*TokenBucket{}}
+
+// RateLimiterFor returns the shared bucket for the host of rawURL.
+func RateLimiterFor(rawURL string) *TokenBucket {
+	host := rawURL
+	if parsed, err := url.Parse(rawURL); err == nil && parsed.Host != "" {
+		host = parsed.Host
+	}
+
+	rateLimiters.Lock()
+	defer rateLimiters.Unlock()
+
+	if bucket, ok := rateLimiters.buckets[host]; ok {
+		return bucket
+	}
+
+	limit := 0
+	if config, ok := defaultTPM[host]; ok {
+		limit = config.limit
+		if value, err := strconv.Atoi(os.Getenv(config.env)); err == nil && value > 0 {
+			limit = value
+		}
+	}
+
+	bucket := &TokenBucket{
+		name:      host,
+		capacity:  float64(limit),
+		tokens:    float64(limit),
+		perSecond: float64(limit) / 60,
+		last:      time.Now(),
+	}
+	rateLimiters.buckets[host] = bucket
+	return bucket
+}
+
+// Reserve blocks until n tokens are available and claims them, or until ctx is done.
+func (b *TokenBucket) Reserve(ctx context.Context, n int) (*Reservation, error) {
+	for {
+		wait := b.tryTake(n)
+		if wait <= 0 {
+			return &Reservation{bucket: b, tokens: n}, nil
+		}
+		log.Printf("Rate limit %s: waiting %s for %d tokens", b.name, wait.Round(time.Millisecond), n)
+		if err := sleepContext(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// tryTake claims n tokens, or reports how long to wait before trying again.
+func (b *TokenBucket) tryTake(n int) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(b.blockedUntil) {
+		return b.blockedUntil.Sub(now)
+	}
+	if b.capacity == 0 {
+		return 0
+	}
+
+	b.refill(now)
+	// A request larger than the whole budget can only run on a full bucket.
+	need := float64(n)
+	if need > b.capacity {
+		need = b.capacity
+	}
+	if b.tokens >= need {
+		b.tokens -= float64(n)
+		return 0
+	}
+	return time.Duration((need - b.tokens) / b.perSecond * float64(time.Second))
+}
+
+func (b *TokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.perSecond
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.last = now
+}
+
+// adjust returns tokens to the bucket (or takes more when negative).
+func (b *TokenBucket) adjust(tokens int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.capacity == 0 {
+		return
+	}
+	b.refill(time.Now())
+	b.tokens += float64(tokens)
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+}
+
+// Observe applies the upstream's own rate limit headers to the bucket.
+func (b *TokenBucket) Observe(resp *http.Response) {
+	if resp == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+
+	if b.capacity > 0 {
+		if remaining, err := strconv.ParseFloat(resp.Header.Get("x-ratelimit-remaining-tokens"), 64); err == nil {
+			b.refill(now)
+			if remaining < b.tokens {
+				b.tokens = remaining
+			}
+		}
+	}
+
+	var until time.Time
+	if resp.StatusCode == http.StatusTooManyRequests {
+		if wait, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			until = now.Add(wait)
+		} else {
+			until = now.Add(time.Second)
+		}
+	}
+	for _, header := range []string{"x-ratelimit-remaining-tokens", "x-ratelimit-remaining-requests"} {
+		if resp.Header.Get(header) != "0" {
+			continue
+		}
+		resetHeader := strings.Replace(header, "remaining", "reset", 1)
+		if wait, err := time.ParseDuration(resp.Header.Get(resetHeader)); err == nil && now.Add(wait).After(until) {
+			until = now.Add(wait)
+		}
+	}
+
+	if until.After(b.blockedUntil) {
+		b.blockedUntil = until
+	}
+}
+
+// Settle corrects the reservation to the tokens the upstream reported using.
+// A non-positive actual keeps the estimate.
+func (r *Reservation) Settle(actual int) {
+	if r == nil || actual <= 0 {
+		return
+	}
+	r.bucket.adjust(r.tokens - actual)
+}
+
+// Cancel returns the whole reservation, for requests the upstream rejected.
+func (r *Reservation) Cancel() {
+	if r == nil {
+		return
+	}
+	r.bucket.adjust(r.tokens)
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second)), true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date), true
+	}
+	return 0, false
+}
+
+// doRateLimited sends the request built by newRequest under the upstream's token budget.
+// Requests rejected with 429 are retried once the advertised wait has passed; other
+// failures are retried by DoUpstream according to policy.
+// On success the caller settles the returned reservation with the reported usage.
+func doRateLimited(ctx context.Context, rawURL string, estimate int, policy RetryPolicy, newRequest func() (*http.Request, error)) (*http.Response, *Reservation, error) {
+	bucket := RateLimiterFor(rawURL)
+
+	for attempt := 0; ; attempt++ {
+		reservation, err := bucket.Reserve(ctx, estimate)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		req, err := newRequest()
+		if err != nil {
+			reservation.Cancel()
+			return nil, nil, err
+		}
+
+		policy.PassRateLimits = true
+		resp, err := DoUpstream(req, policy)
+		if err != nil {
+			reservation.Cancel()
+			return nil, nil, err
+		}
+		bucket.Observe(resp)
+
+		if resp.StatusCode != http.StatusTooManyRequests || attempt >= maxRateLimitRetries {
+			return resp, reservation, nil
+		}
+
+		log.Printf("Rate limited by %s, retrying (attempt %d)", bucket.name, attempt+1)
+		resp.Body.Close()
+		reservation.Cancel()
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// PII entity types, in the order they claim overlapping text.
+var piiTypes = []string{"api_key", "email", "iban", "credit_card", "phone"}
+
+var piiPatterns = map[string]*regexp.Regexp{
+	"api_key":     regexp.MustCompile(`\b(?:sk-(?:proj-)?[A-Za-z0-9_-]{20,}|gsk_[A-Za-z0-9]{20,}|AKIA[0-9A-Z]{16}|gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,}|xox[abposr]-[A-Za-z0-9-]{10,}|AIza[0-9A-Za-z_-]{35}|eyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,})`),
+	"email":       regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`),
+	"iban":        regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]){11,30}\b`),
+	"credit_card": regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+	"phone":       regexp.MustCompile(`\+?\(?\d[\d ().\-/]{6,20}\d`),
+}
+
+// piiValidators reject pattern matches that fail a checksum or are likely something else.
+// They return the part of the match that is the entity, or "" to reject it.
+var piiValidators = map[string]func(string) string{
+	"iban":        validIBAN,
+	"credit_card": validCard,
+	"phone":       validPhone,
+}
+
+var (
+	isoDate    = regexp.MustCompile(`^\d{4}[-/.]\d{2}[-/.]\d{2}$`)
+	localDate  = regexp.MustCompile(`^\d{1,2}[-/.]\d{1,2}[-/.]\d{2,4}$`)
+	yearRange  = regexp.MustCompile(`^(?:1[89]|20)\d{2} ?[-/] ?(?:1[89]|20)\d{2}$`)
+	digitGroup = regexp.MustCompile(`\d+`)
+)
+
+// RedactOptions configures the PII stage of /chunk.
+type RedactOptions struct {
+	Mode  string   // "" (off), "mask", "hash" or "drop" (leave out sentences containing PII)
+	Types []string // Entity types to look for, empty for all
+}
+
+// DefaultRedactOptions reads PII_REDACTION and PII_TYPES (comma separated).
+func DefaultRedactOptions() RedactOptions {
+	opts := RedactOptions{Mode: os.Getenv("PII_REDACTION")}
+	if types := os.Getenv("PII_TYPES"); types != "" {
+		for _, piiType := range strings.Split(types, ",") {
+			opts.Types = append(opts.Types, strings.TrimSpace(piiType))
+		}
+	}
+	return opts
+}
+
+func (o RedactOptions) Validate() error {
+	switch o.Mode {
+	case "", "mask", "drop":
+	case "hash":
+		// Unkeyed digests of phone or card numbers can be reversed by enumeration.
+		if os.Getenv("PII_HASH_SALT") == "" {
+			return fmt.Errorf("redaction mode hash needs PII_HASH_SALT")
+		}
+	default:
+		return fmt.Errorf("unknown redaction mode %q, expected mask, hash or drop", o.Mode)
+	}
+	for _, piiType := range o.Types {
+		if piiPatterns[piiType] == nil {
+			return fmt.Errorf("unknown PII type %q, expected one of %s", piiType, strings.Join(piiTypes, ", "))
+		}
+	}
+	return nil
+}
+
+func (o RedactOptions) enabled(piiType string) bool {
+	if len(o.Types) == 0 {
+		return true
+	}
+	for _, t := range o.Types {
+		if t == piiType {
+			return true
+		}
+	}
+	return false
+}
+
+// redactSentences removes PII from whole sentences, before SentenceChunk cuts, groups
+// or overlaps them, so no chunk can carry a fragment of an entity that no longer
+// matches on its own. It returns the entity types found in each kept sentence; in
+// drop mode sentences with PII are left out and counted.
+func redactSentences(sentences []string, spans [][2]int, opts RedactOptions) ([]string, [][2]int, [][]string, int) {
+	var keptSentences []string
+	var keptSpans [][2]int
+	var found [][]string
+	dropped := 0
+	for i, sentence := range sentences {
+		redacted, types := RedactText(sentence, opts)
+		if len(types) > 0 && opts.Mode == "drop" {
+			dropped++
+			continue
+		}
+		keptSentences = append(keptSentences, redacted)
+		keptSpans = append(keptSpans, spans[i])
+		found = append(found, mergePIITypes(nil, types))
+	}
+	return keptSentences, keptSpans, found, dropped
+}
+
+// mergePIITypes returns the sorted union of two lists of entity types.
+func mergePIITypes(a, b []string) []string {
+	seen := map[string]bool{}
+	var merged []string
+	for _, piiType := range append(append([]string{}, a...), b...) {
+		if !seen[piiType] {
+			seen[piiType] = true
+			merged = append(merged, piiType)
+		}
+	}
+	sort.Strings(merged)
+	return merged
+}
+
+type piiMatch struct {
+	start, end int
+	piiType    string
+}
+
+// RedactText replaces PII in text according to opts and returns the types it found.
+func RedactText(text string, opts RedactOptions) (string, []string) {
+	var matches []piiMatch
+	for _, piiType := range piiTypes {
+		if !opts.enabled(piiType) {
+			continue
+		}
+		for _, loc := range piiPatterns[piiType].FindAllStringIndex(text, -1) {
+			start, end := loc[0], loc[1]
+			if validate := piiValidators[piiType]; validate != nil {
+				entity := validate(text[start:end])
+				if entity == "" || !standsAlone(text, start, start+len(entity)) {
+					continue
+				}
+				end = start + len(entity)
+			}
+			if !overlapsAny(matches, start, end) {
+				matches = append(matches, piiMatch{start: start, end: end, piiType: piiType})
+			}
+		}
+	}
+	if len(matches) == 0 {
+		return text, nil
+	}
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i].start < matches[j].start })
+
+	var builder strings.Builder
+	var types []string
+	last := 0
+	for _, match := range matches {
+		builder.WriteString(text[last:match.start])
+		builder.WriteString(piiReplacement(match.piiType, text[match.start:match.end], opts.Mode))
+		last = match.end
+		types = append(types, match.piiType)
+	}
+	builder.WriteString(text[last:])
+	return builder.String(), types
+}
+
+// piiReplacement is "[EMAIL]" when masking. Hashing adds an HMAC keyed with
+// PII_HASH_SALT so the same value can be matched across chunks without being stored.
+func piiReplacement(piiType, value, mode string) string {
+	label := strings.ToUpper(piiType)
+	if mode != "hash" {
+		return "[" + label + "]"
+	}
+	mac := hmac.New(sha256.New, []byte(os.Getenv("PII_HASH_SALT")))
+	mac.Write([]byte(piiType + ":" + value))
+	return "[" + label + ":" + hex.EncodeToString(mac.Sum(nil)[:6]) + "]"
+}
+
+func overlapsAny(matches []piiMatch, start, end int) bool {
+	for _, match := range matches {
+		if start < match.end && match.start < end {
+			return true
+		}
+	}
+	return false
+}
+
+// standsAlone rejects numbers that are part of a longer token, like the tail of a UUID.
+func standsAlone(text string, start, end int) bool {
+	joins := func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_'
+	}
+	if start > 0 && joins(rune(text[start-1])) {
+		return false
+	}
+	if end < len(text) && joins(rune(text[end])) {
+		return false
+	}
+	return true
+}
+
+// validIBAN returns the longest prefix of candidate, cut between groups, that passes mod-97.
+func validIBAN(candidate string) string {
+	groups := strings.Split(candidate, " ")
+	for n := len(groups); n > 0; n-- {
+		prefix := strings.Join(groups[:n], " ")
+		compact := strings.ReplaceAll(prefix, " ", "")
+		if len(compact) >= 15 && len(compact) <= 34 && ibanChecksum(compact) {
+			return prefix
+		}
+	}
+	return ""
+}
+
+func ibanChecksum(iban string) bool {
+	rearranged := iban[4:] + iban[:4]
+	remainder := 0
+	for _, r := range rearranged {
+		switch {
+		case r >= '0' && r <= '9':
+			remainder = (remainder*10 + int(r-'0')) % 97
+		case r >= 'A' && r <= 'Z':
+			remainder = (remainder*100 + int(r-'A'+10)) % 97
+		default:
+			return false
+		}
+	}
+	return remainder == 1
+}
+
+// validCard accepts 13 to 19 digits that pass the Luhn check.
+func validCard(candidate string) string {
+	digits := onlyDigits(candidate)
+	if len(digits) < 13 || len(digits) > 19 {
+		return ""
+	}
+	sum := 0
+	for i := 0; i < len(digits); i++ {
+		digit := int(digits[len(digits)-1-i] - '0')
+		if i%2 == 1 {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+	}
+	if sum%10 != 0 {
+		return ""
+	}
+	return candidate
+}
+
+// validPhone accepts 8 to 15 digits (E.164) shaped like a phone number: an
+// international "+" or "00" prefix, an area code in brackets, three or more digit
+// groups, or two groups behind a trunk "0". Dates, year ranges, dotted numbers
+// like IP addresses and bare digit runs such as order numbers are skipped.
+func validPhone(candidate string) string {
+	candidate = strings.TrimRight(candidate, " .-/(")
+	digits := onlyDigits(candidate)
+	if len(digits) < 8 || len(digits) > 15 {
+		return ""
+	}
+	if isoDate.MatchString(candidate) || localDate.MatchString(candidate) || yearRange.MatchString(candidate) {
+		return ""
+	}
+	if strings.HasPrefix(candidate, "+") || strings.HasPrefix(candidate, "00") {
+		return candidate
+	}
+	if strings.Contains(candidate, ".") {
+		return ""
+	}
+
+	groups := digitGroup.FindAllString(candidate, -1)
+	switch {
+	case strings.HasPrefix(candidate, "(") && strings.Contains(candidate, ")"):
+	case len(groups) >= 3:
+	case len(groups) == 2 && strings.HasPrefix(groups[0], "0"):
+	default:
+		return ""
+	}
+	return candidate
+}
+
+func onlyDigits(text string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, text)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidIBAN(t *testing.T) {
+	tests := []struct {
+		candidate string
+		want      string
+	}{
+		{"DE89 3704 0044 0532 0130 00", "DE89 3704 0044 0532 0130 00"},
+		{"DE89370400440532013000", "DE89370400440532013000"},
+		{"GB82 WEST 1234 5698 7654 32", "GB82 WEST 1234 5698 7654 32"},
+		{"DE89 3704 0044 0532 0130 00 AND", "DE89 3704 0044 0532 0130 00"}, // Trailing word cut off
+		{"DE88 3704 0044 0532 0130 00", ""},                                // Wrong check digits
+		{"DE89 3704", ""},                                                  // Too short
+	}
+	for _, test := range tests {
+		if got := validIBAN(test.candidate); got != test.want {
+			t.Errorf("validIBAN(%q) = %q, want %q", test.candidate, got, test.want)
+		}
+	}
+}
+
+func TestValidCard(t *testing.T) {
+	tests := []struct {
+		candidate string
+		valid     bool
+	}{
+		{"4111 1111 1111 1111", true},
+		{"4111-1111-1111-1111", true},
+		{"5500005555555559", true},
+		{"378282246310005", true}, // 15-digit Amex
+		{"4111 1111 1111 1112", false},
+		{"1234567890123", false},
+		{"411111111111", false}, // 12 digits
+	}
+	for _, test := range tests {
+		if got := validCard(test.candidate) != ""; got != test.valid {
+			t.Errorf("validCard(%q) valid = %v, want %v", test.candidate, got, test.valid)
+		}
+	}
+}
+
+func TestValidPhone(t *testing.T) {
+	tests := []struct {
+		candidate string
+		valid     bool
+	}{
+		{"+49 30 1234567", true},
+		{"+4930123456789", true},
+		{"0049 30 1234567", true},
+		{"(555) 123-4567", true},
+		{"555-123-4567", true},
+		{"030 1234567", true},
+		{"0171-1234567", true},
+		{"2024-2025", false},       // Year range
+		{"1998 - 2004", false},     // Year range
+		{"1234567890123", false},   // Bare digit run, e.g. an order number
+		{"2024-01-15", false},      // ISO date
+		{"15/01/2024", false},      // Local date
+		{"192.168.178.136", false}, // IP address
+		{"3.14159265", false},      // Decimal number
+		{"1234 5678", false},       // Two groups without a trunk prefix
+		{"+49 30", false},          // Too few digits
+	}
+	for _, test := range tests {
+		if got := validPhone(test.candidate) != ""; got != test.valid {
+			t.Errorf("validPhone(%q) valid = %v, want %v", test.candidate, got, test.valid)
+		}
+	}
+}
+
+func TestRedactText(t *testing.T) {
+	tests := []struct {
+		text  string
+		want  string
+		types []string
+	}{
+		{"Mail john.doe@example.com today", "Mail [EMAIL] today", []string{"email"}},
+		{"Call +49 30 1234567, please", "Call [PHONE], please", []string{"phone"}},
+		{"IBAN DE89 3704 0044 0532 0130 00 AND more", "IBAN [IBAN] AND more", []string{"iban"}},
+		{"Card 4111 1111 1111 1111.", "Card [CREDIT_CARD].", []string{"credit_card"}},
+		{"key sk-proj-abcdefghijklmnopqrstuvwx", "key [API_KEY]", []string{"api_key"}},
+		{"Room 2024-2025 budget", "Room 2024-2025 budget", nil},
+		{"Order number 1234567890123 shipped", "Order number 1234567890123 shipped", nil},
+		{"id 550e8400-e29b-41d4-a716-446655440000", "id 550e8400-e29b-41d4-a716-446655440000", nil},
+	}
+	for _, test := range tests {
+		got, types := RedactText(test.text, RedactOptions{Mode: "mask"})
+		if got != test.want || !reflect.DeepEqual(types, test.types) {
+			t.Errorf("RedactText(%q) = %q %v, want %q %v", test.text, got, types, test.want, test.types)
+		}
+	}
+}
+
+func TestHashModeNeedsSalt(t *testing.T) {
+	t.Setenv("PII_HASH_SALT", "")
+	if err := (RedactOptions{Mode: "hash"}).Validate(); err == nil {
+		t.Fatal("hash mode without PII_HASH_SALT validated")
+	}
+
+	t.Setenv("PII_HASH_SALT", "pepper")
+	if err := (RedactOptions{Mode: "hash"}).Validate(); err != nil {
+		t.Fatal(err)
+	}
+	first, _ := RedactText("Mail a@example.com", RedactOptions{Mode: "hash"})
+	second, _ := RedactText("Mail a@example.com", RedactOptions{Mode: "hash"})
+	if first != second || !strings.HasPrefix(first, "Mail [EMAIL:") {
+		t.Errorf("hash replacement not stable: %q, %q", first, second)
+	}
+
+	t.Setenv("PII_HASH_SALT", "salt")
+	if other, _ := RedactText("Mail a@example.com", RedactOptions{Mode: "hash"}); other == first {
+		t.Errorf("hash replacement does not depend on the salt: %q", other)
+	}
+}
+
+func TestChunksCarryNoPartOfRedactedEntities(t *testing.T) {
+	text := "Hello there. Thanks a lot. Card 4111 1111 1111 1111 ok. Bye now. Mail john.doe@example.com today. See you."
+	fragments := []string{"4111", "1111", "john", "doe", "example.com"}
+
+	for _, mode := range []string{"mask", "drop"} {
+		for _, target := range []int{0, 12} {
+			chunks := SentenceChunk(text, "test", ChunkOptions{TargetTokens: target, Redaction: RedactOptions{Mode: mode}})
+			if len(chunks) == 0 {
+				t.Fatalf("%s/%d: no chunks", mode, target)
+			}
+			for _, chunk := range chunks {
+				for _, fragment := range fragments {
+					if strings.Contains(chunk.Text, fragment) || strings.Contains(chunk.Sentence, fragment) {
+						t.Errorf("%s/%d: chunk %q leaks %q", mode, target, chunk.Text, fragment)
+					}
+				}
+			}
+		}
+	}
+
+	chunks := SentenceChunk(text, "test", ChunkOptions{Redaction: RedactOptions{Mode: "mask"}})
+	var typed []string
+	for _, chunk := range chunks {
+		if types, ok := chunk.Metadata["pii_types"].([]string); ok {
+			typed = append(typed, chunk.Sentence+" "+strings.Join(types, ","))
+		}
+	}
+	want := []string{"Card [CREDIT_CARD] ok. credit_card", "Mail [EMAIL] today. email"}
+	if !reflect.DeepEqual(typed, want) {
+		t.Errorf("pii_types = %q, want %q", typed, want)
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const defaultRegistryPath = "collections.json"
+const defaultCollectionName = "Database"
+const aliasCacheTTL = 30 * time.Second
+
+var ErrCollectionNotFound = errors.New("collection not found")
+
+type CollectionInfo struct {
+	Name           string    `json:"name"`
+	EmbeddingModel string    `json:"embedding_model"`
+	Dimension      int       `json:"dimension"`
+	Distance       string    `json:"distance,omitempty"`
+	VectorName     string    `json:"vector_name,omitempty"` // Named vector Chisel embeds into, empty for unnamed
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// CollectionRegistry tracks which collections exist and how they are embedded.
+// It is cached as JSON at CHISEL_REGISTRY_PATH; the embedding model is also stored
+// in each collection's Qdrant metadata, which is what survives a redeploy.
+// Collections created outside Chisel are picked up from Qdrant on first use.
+type CollectionRegistry struct {
+	mu          sync.RWMutex
+	path        string
+	defaultName string
+	collections map[string]CollectionInfo
+
+	aliasMu       sync.Mutex
+	aliases       map[string]string // Alias -> collection, cached from Qdrant
+	aliasesFetch  time.Time         // Zero after InvalidateAliases
+	aliasGen      int               // Bumped by InvalidateAliases
+	aliasRefresh  chan struct{}     // Closed when the refresh in flight finishes
+	aliasFailures int
+	aliasRetryAt  time.Time // No refresh before this after failures
+}
+
+var registry = NewCollectionRegistry(os.Getenv("CHISEL_REGISTRY_PATH"), os.Getenv("CHISEL_DEFAULT_COLLECTION"))
+
+func NewCollectionRegistry(path, defaultName string) *CollectionRegistry {
+	if path == "" {
+		path = defaultRegistryPath
+	}
+	if defaultName == "" {
+		defaultName = defaultCollectionName
+	}
+
+	r := &CollectionRegistry{
+		path:        path,
+		defaultName: defaultName,
+		collections: map[string]CollectionInfo{},
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Error reading collection registry: %v", err)
+		}
+		return r
+	}
+	if err := json.Unmarshal(data, &r.collections); err != nil {
+		log.Printf("Error parsing collection registry: %v", err)
+	}
+	return r
+}
+
+// Default returns the collection used when a request doesn't name one.
+func (r *CollectionRegistry) Default() string {
+	return r.defaultName
+}
+
+// Resolve returns the collection behind a name: the default collection for an
+// empty name, the aliased collection for an alias, or the name itself.
+func (r *CollectionRegistry) Resolve(name string) string {
+	if name == "" {
+		name = r.defaultName
+	}
+	if collection, ok := r.Aliases()[name]; ok {
+		return collection
+	}
+	return name
+}
+
+// Aliases returns the alias mapping. A stale cache is served while one background
+// refresh runs; callers only wait when nothing is cached yet or after InvalidateAliases.
+func (r *CollectionRegistry) Aliases() map[string]string {
+	r.aliasMu.Lock()
+	defer r.aliasMu.Unlock()
+
+	for {
+		stale := r.aliases == nil || time.Since(r.aliasesFetch) > aliasCacheTTL
+		if stale && r.aliasRefresh == nil && !time.Now().Before(r.aliasRetryAt) {
+			r.aliasRefresh = make(chan struct{})
+			go r.refreshAliases(r.aliasRefresh, r.aliasGen)
+		}
+
+		wait := r.aliasRefresh
+		if wait == nil || (r.aliases != nil && !r.aliasesFetch.IsZero()) {
+			break
+		}
+		r.aliasMu.Unlock()
+		<-wait
+		r.aliasMu.Lock()
+	}
+
+	aliases := make(map[string]string, len(r.aliases))
+	for alias, collection := range r.aliases {
+		aliases[alias] = collection
+	}
+	return aliases
+}
+
+// refreshAliases fetches the aliases without holding aliasMu. Failures back off
+// exponentially up to the cache TTL instead of being retried on every request.
+func (r *CollectionRegistry) refreshAliases(done chan struct{}, gen int) {
+	// The cache is shared across requests, so one client going away mustn't abort the refresh.
+	aliases, err := ListQdrantAliases(context.Background())
+
+	r.aliasMu.Lock()
+	defer r.aliasMu.Unlock()
+	defer close(done)
+	r.aliasRefresh = nil
+
+	if err != nil {
+		r.aliasFailures++
+		backoff := min(time.Second<<min(r.aliasFailures-1, 10), aliasCacheTTL)
+		r.aliasRetryAt = time.Now().Add(backoff)
+		log.Printf("Error refreshing aliases, retrying in %s: %v", backoff, err)
+		return
+	}
+
+	r.aliases = aliases
+	r.aliasFailures, r.aliasRetryAt = 0, time.Time{}
+	// An invalidation during the fetch means Qdrant may have changed since it started.
+	if gen == r.aliasGen {
+		r.aliasesFetch = time.Now()
+	}
+}
+
+// InvalidateAliases forces the next alias resolution to ask Qdrant.
+func (r *CollectionRegistry) InvalidateAliases() {
+	r.aliasMu.Lock()
+	defer r.aliasMu.Unlock()
+	r.aliasesFetch = time.Time{}
+	r.aliasGen++
+	r.aliasRetryAt = time.Time{}
+}
+
+// Get returns a collection's info, asking Qdrant about collections the registry hasn't seen yet.
+// Aliases are resolved to the collection they point at.
+func (r *CollectionRegistry) Get(ctx context.Context, name string) (CollectionInfo, error) {
+	name = r.Resolve(name)
+
+	r.mu.RLock()
+	info, ok := r.collections[name]
+	r.mu.RUnlock()
+	if ok {
+		return info, nil
+	}
+
+	info, err := GetQdrantCollectionConfig(ctx, name)
+	if err != nil {
+		return CollectionInfo{}, err
+	}
+
+	// Without Chisel's metadata the collection was created elsewhere, so the model
+	// is a guess based on the vector size.
+	if info.EmbeddingModel == "" {
+		if EmbeddingDimension(DefaultEmbeddingModel()) == info.Dimension {
+			info.EmbeddingModel = DefaultEmbeddingModel()
+		} else {
+			for model, size := range embeddingDimensions {
+				if size == info.Dimension {
+					info.EmbeddingModel = model
+					break
+				}
+			}
+		}
+	}
+
+	return info, r.Register(info)
+}
+
+// Ensure returns a collection's info, creating the collection with the default model when create is set.
+func (r *CollectionRegistry) Ensure(ctx context.Context, name string, create bool) (CollectionInfo, error) {
+	info, err := r.Get(ctx, name)
+	if !errors.Is(err, ErrCollectionNotFound) || !create {
+		return info, err
+	}
+
+	log.Printf("Creating missing collection %s", name)
+	return r.Create(ctx, name, DefaultEmbeddingModel(), CollectionConfig{})
+}
+
+// Create creates a collection sized for the embedding model and registers it.
+func (r *CollectionRegistry) Create(ctx context.Context, name, model string, config CollectionConfig) (CollectionInfo, error) {
+	dimension := EmbeddingDimension(model)
+	if dimension == 0 {
+		return CollectionInfo{}, fmt.Errorf("unknown dimension for embedding model %q", model)
+	}
+	if err := config.Prepare(dimension); err != nil {
+		return CollectionInfo{}, err
+	}
+
+	createdAt := time.Now()
+	metadata := collectionMetadata{EmbeddingModel: model, CreatedAt: createdAt}
+	if err := CreateQdrantCollection(ctx, name, config, metadata); err != nil {
+		return CollectionInfo{}, err
+	}
+	if err := CreateStandardIndexes(ctx, name); err != nil {
+		log.Printf("Error creating payload indexes for %s: %v", name, err)
+	}
+
+	info := CollectionInfo{
+		Name:           name,
+		EmbeddingModel: model,
+		Dimension:      dimension,
+		Distance:       config.EmbeddedDistance(),
+		VectorName:     config.VectorName(),
+		CreatedAt:      createdAt,
+	}
+	return info, r.Register(info)
+}
+
+// Register records a collection and persists the registry.
+func (r *CollectionRegistry) Register(info CollectionInfo) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collections[info.Name] = info
+	return r.save()
+}
+
+// Remove forgets a collection and persists the registry.
+func (r *CollectionRegistry) Remove(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.collections, name)
+	return r.save()
+}
+
+// save writes the registry to disk. Callers must hold the write lock.
+func (r *CollectionRegistry) save() error {
+	data, err := json.MarshalIndent(r.collections, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal collection registry: %w", err)
+	}
+	if err := os.WriteFile(r.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write collection registry: %w", err)
+	}
+	return nil
+}
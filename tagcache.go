@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bufio"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const defaultTagCachePath = "tag-cache.jsonl"
+const defaultTagCacheSize = 50000 // Entries kept, least recently used go first
+
+// TagCache remembers LLM tags by prompt version + model + sha256(text), so identical
+// chunks such as footers and repeated headers are only tagged once. Entries are
+// appended to a JSON-lines file and reloaded on start; bumping tagPromptVersion
+// or changing the model misses the old entries, and compaction drops those from
+// older prompt versions. Memory is capped by an LRU.
+type TagCache struct {
+	mu       sync.Mutex
+	path     string // Empty keeps the cache in memory only
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List // Front is most recently used
+	file     *os.File
+	lines    int // Records in the file, counting overwritten and evicted ones
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+type tagCacheRecord struct {
+	Key  string   `json:"key"`
+	Tags []string `json:"tags"`
+}
+
+// tagCache is persisted at TAG_CACHE_PATH, "off" keeps it in memory, and holds up
+// to TAG_CACHE_SIZE entries.
+var tagCache = NewTagCache(tagCachePath(), envInt("TAG_CACHE_SIZE", defaultTagCacheSize))
+
+func tagCachePath() string {
+	switch path := os.Getenv("TAG_CACHE_PATH"); path {
+	case "":
+		return defaultTagCachePath
+	case "off":
+		return ""
+	default:
+		return path
+	}
+}
+
+func NewTagCache(path string, capacity int) *TagCache {
+	c := &TagCache{path: path, capacity: capacity, entries: map[string]*list.Element{}, order: list.New()}
+	if path == "" {
+		return c
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Error reading tag cache: %v", err)
+		}
+		return c
+	}
+	defer file.Close()
+
+	stale := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var record tagCacheRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil || record.Key == "" {
+			continue
+		}
+		c.lines++
+		if !currentTagPrompt(record.Key) {
+			stale++
+			continue
+		}
+		c.remember(record.Key, record.Tags)
+	}
+	if err := scanner.Err(); err != nil {
+		log.Printf("Error reading tag cache: %v", err)
+	}
+
+	if stale > 0 || c.lines > 2*len(c.entries) {
+		if err := c.compact(); err != nil {
+			log.Printf("Error compacting tag cache: %v", err)
+		}
+	}
+	return c
+}
+
+// currentTagPrompt reports whether a cache key was made with the current tagPromptVersion.
+func currentTagPrompt(key string) bool {
+	rest, ok := strings.CutPrefix(key, tagPromptVersion)
+	return ok && (strings.HasPrefix(rest, ":") || strings.HasPrefix(rest, "@"))
+}
+
+// tagCacheKey identifies the prompt by version and requested tag language.
+func tagCacheKey(model, language, text string) string {
+	sum := sha256.Sum256([]byte(text))
+	prompt := tagPromptVersion
+	if language != "" {
+		prompt += "@" + strings.ToLower(language)
+	}
+	return prompt + ":" + model + ":" + hex.EncodeToString(sum[:])
+}
+
+func (c *TagCache) Get(model, language, text string) ([]string, bool) {
+	c.mu.Lock()
+	var tags []string
+	element, ok := c.entries[tagCacheKey(model, language, text)]
+	if ok {
+		c.order.MoveToFront(element)
+		tags = element.Value.(*tagCacheRecord).Tags
+	}
+	c.mu.Unlock()
+
+	if ok {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+	return tags, ok
+}
+
+// Put records tags for text and appends them to the cache file.
+func (c *TagCache) Put(model, language, text string, tags []string) {
+	key := tagCacheKey(model, language, text)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.capacity <= 0 {
+		return
+	}
+	c.remember(key, tags)
+	if c.path == "" {
+		return
+	}
+
+	// Overwritten and evicted records pile up in the file; rewrite it once they
+	// make up half of it.
+	if c.lines >= 2*c.capacity && c.lines > 2*len(c.entries) {
+		if c.file != nil {
+			c.file.Close()
+			c.file = nil
+		}
+		if err := c.compact(); err != nil {
+			log.Printf("Error compacting tag cache: %v", err)
+		} else {
+			return // The rewrite already holds the new entry
+		}
+	}
+
+	if c.file == nil {
+		file, err := os.OpenFile(c.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			log.Printf("Error opening tag cache: %v", err)
+			return
+		}
+		c.file = file
+	}
+
+	line, _ := json.Marshal(tagCacheRecord{Key: key, Tags: tags})
+	if _, err := c.file.Write(append(line, '\n')); err != nil {
+		log.Printf("Error writing tag cache: %v", err)
+		return
+	}
+	c.lines++
+}
+
+// remember stores tags in memory, evicting the least recently used entries beyond
+// capacity. Callers must hold mu, except while NewTagCache loads the file.
+func (c *TagCache) remember(key string, tags []string) {
+	if c.capacity <= 0 {
+		return
+	}
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*tagCacheRecord).Tags = tags
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&tagCacheRecord{Key: key, Tags: tags})
+
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*tagCacheRecord).Key)
+	}
+}
+
+// compact rewrites the cache file with one line per entry, least recently used first
+// so a reload keeps the LRU order. Callers must hold mu with the append file closed.
+func (c *TagCache) compact() error {
+	tmp := c.path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	for element := c.order.Back(); element != nil; element = element.Prev() {
+		line, _ := json.Marshal(element.Value.(*tagCacheRecord))
+		writer.Write(append(line, '\n'))
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return err
+	}
+	c.lines = len(c.entries)
+	return nil
+}
+
+func (c *TagCache) Stats() CacheStats {
+	c.mu.Lock()
+	entries := len(c.entries)
+	c.mu.Unlock()
+
+	stats := CacheStats{
+		Entries:  entries,
+		Capacity: c.capacity,
+		Hits:     c.hits.Load(),
+		Misses:   c.misses.Load(),
+		Disk:     c.path != "",
+	}
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(total)
+	}
+	return stats
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTagCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := NewTagCache("", 2)
+	cache.Put("m", "", "a", []string{"a"})
+	cache.Put("m", "", "b", []string{"b"})
+	cache.Get("m", "", "a")
+	cache.Put("m", "", "c", []string{"c"})
+
+	if _, ok := cache.Get("m", "", "b"); ok {
+		t.Error("least recently used entry b survived")
+	}
+	for _, text := range []string{"a", "c"} {
+		if tags, ok := cache.Get("m", "", text); !ok || tags[0] != text {
+			t.Errorf("Get(%q) = %v, %v", text, tags, ok)
+		}
+	}
+	if stats := cache.Stats(); stats.Entries != 2 || stats.Capacity != 2 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestTagCacheCompactionDropsOldPromptVersions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tags.jsonl")
+	cache := NewTagCache(path, 100)
+	cache.Put("m", "", "current", []string{"x"})
+	cache.file.Close()
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A key from an older prompt version and one whose version merely shares a prefix.
+	file.WriteString(`{"key":"1:m:abc","tags":["old"]}` + "\n")
+	file.WriteString(`{"key":"` + tagPromptVersion + `0:m:abc","tags":["old"]}` + "\n")
+	file.Close()
+
+	reloaded := NewTagCache(path, 100)
+	if tags, ok := reloaded.Get("m", "", "current"); !ok || tags[0] != "x" {
+		t.Errorf("current entry lost: %v, %v", tags, ok)
+	}
+	if entries := reloaded.Stats().Entries; entries != 1 {
+		t.Errorf("entries = %d, want 1", entries)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 1 || strings.Contains(string(data), "old") {
+		t.Errorf("compacted file still holds stale keys:\n%s", data)
+	}
+}
@@ -1,160 +1,190 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
-	"io"
-	"net/http"
-	"os"
+	"log"
 	"regexp"
+	"strconv"
 	"strings"
-	"time"
 )
 
 const groqAPIURL = "https://api.groq.com/openai/v1/chat/completions"
 const groqModel = "llama-3.1-8b-instant"
 
+// tagPromptVersion is part of every tag cache key; bump it whenever tagSystemPrompt
+// or the way responses are parsed changes, so cached tags from the old prompt are ignored.
+const tagPromptVersion = "2"
+
 var tagSystemPrompt = `You are a semantic tag generator.
-Given several numbered chunks of text, output a corresponding list of tag groups.
+Given several numbered chunks of text, output one tag group per chunk.
 Each tag group summarizes the key topics, concepts, or categories from its associated chunk.
-Use only lowercase where possible. Each tag group should be a single line of up to 20 tags separated by '|'.
-Output only the tag lines, one per chunk, in the same order.`
+Use only lowercase where possible and at most 20 tags per chunk.
+Respond with a single JSON object mapping every chunk number to its list of tags, e.g.
+{"1": ["tag", "another tag"], "2": ["tag"]}
+Include every chunk number exactly once and nothing else.`
 
 var prefixRegex = regexp.MustCompile(`^\d+\.\s*`)
 
-// BatchGenerateTags takes a slice of chunk texts and returns a slice of tag lists.
-func BatchGenerateTags(chunkTexts []string) ([][]string, error) {
-	if len(chunkTexts) == 0 {
-		return [][]string{}, nil
-	}
-
-	const tokenLimit = 1800              // Max tokens per request to avoid 6k TPM issue
-	const tokensPerMinuteLimit = 5500    // Free tier Groq limit (-500 tokens for good measure)
-	var totalTokensUsed = 0              // For throttling
-	var lastFlush time.Time = time.Now() // For rate limiting
+const tagBatchAttempts = 2 // Tries per batch before it gets split
 
-	var allTags [][]string
-	var inputBuilder strings.Builder
-	var currentBatch []string
-	estimateTokens := func(text string) int {
-		return len(text) / 4 // Rough estimation
+// tagPrompt is the system prompt, asking for tags in language when it is set.
+func tagPrompt(language string) string {
+	if language == "" {
+		return tagSystemPrompt
 	}
+	return tagSystemPrompt + "\nWrite every tag in " + LanguageName(language) + ", translating where the text uses another language."
+}
 
-	flushBatch := func() error {
-		if len(currentBatch) == 0 {
-			return nil
-		}
+// BatchGenerateTags takes a slice of chunk texts and returns a slice of tag lists.
+// The result always has one entry per input text, in input order. A non-empty
+// language asks for all tags in that canonical language.
+func BatchGenerateTags(ctx context.Context, provider ChatProvider, language string, chunkTexts []string) ([][]string, error) {
+	systemPrompt := tagPrompt(language)
 
-		userMessage := inputBuilder.String()
-		inputBuilder.Reset()
+	if len(chunkTexts) == 0 {
+		return [][]string{}, nil
+	}
 
-		totalTokensUsed += estimateTokens(userMessage)
-		if totalTokensUsed > tokensPerMinuteLimit {
-			sinceLast := time.Since(lastFlush)
-			if sinceLast < time.Minute {
-				time.Sleep(time.Minute - sinceLast)
-				lastFlush = time.Now()
+	const tokenLimit = 1800 // Max tokens per request to avoid 6k TPM issue
+
+	allTags := make([][]string, len(chunkTexts))
+
+	// tagBatch tags texts[start:end], retrying and then splitting batches whose
+	// response doesn't line up with the chunks that were sent.
+	var tagBatch func(start, end int) error
+	tagBatch = func(start, end int) error {
+		batch := chunkTexts[start:end]
+		userMessage := buildTagMessage(batch)
+
+		var lastErr error
+		for attempt := 0; attempt < tagBatchAttempts; attempt++ {
+			rawOutput, err := ChatCompletionJSON(ctx, provider, []ChatMessage{
+				{Role: "system", Content: systemPrompt},
+				{Role: "user", Content: userMessage},
+			}, 0.3, 2048)
+			if err != nil {
+				return err
 			}
-			totalTokensUsed = estimateTokens(userMessage) // reset to current batch
-		}
-
-		payload := map[string]interface{}{
-			"model": groqModel,
-			"messages": []map[string]string{
-				{"role": "system", "content": tagSystemPrompt},
-				{"role": "user", "content": userMessage},
-			},
-			"temperature": 0.3,
-			"max_tokens":  2048,
-		}
-
-		jsonData, err := json.Marshal(payload)
-		if err != nil {
-			return err
-		}
-
-		req, err := http.NewRequest("POST", groqAPIURL, bytes.NewBuffer(jsonData))
-		if err != nil {
-			return err
-		}
-		req.Header.Set("Authorization", "Bearer "+os.Getenv("GROQ_API_KEY"))
-		req.Header.Set("Content-Type", "application/json")
 
-		resp, err := http.DefaultClient.Do(req)
-		if err != nil {
-			return err
+			batchTags, err := ParseBatchTags(rawOutput, len(batch))
+			if err == nil {
+				copy(allTags[start:end], batchTags)
+				return nil
+			}
+			lastErr = err
+			log.Printf("Tag response for chunks %d-%d misaligned (attempt %d): %v", start+1, end, attempt+1, err)
 		}
-		defer resp.Body.Close()
 
-		if resp.StatusCode != http.StatusOK {
-			bodyBytes, _ := io.ReadAll(resp.Body)
-			return errors.New(string(bodyBytes))
+		if len(batch) == 1 {
+			log.Printf("Giving up on tags for chunk %d: %v", start+1, lastErr)
+			allTags[start] = []string{}
+			return nil
 		}
 
-		var response struct {
-			Choices []struct {
-				Message struct {
-					Content string `json:"content"`
-				} `json:"message"`
-			} `json:"choices"`
-		}
-		err = json.NewDecoder(resp.Body).Decode(&response)
-		if err != nil {
+		mid := start + len(batch)/2
+		if err := tagBatch(start, mid); err != nil {
 			return err
 		}
-
-		rawOutput := strings.TrimSpace(response.Choices[0].Message.Content)
-		batchTags := ParseBatchTags(rawOutput)
-		allTags = append(allTags, batchTags...)
-		currentBatch = nil
-		return nil
+		return tagBatch(mid, end)
 	}
 
-	var tokenCount int
+	batchStart, tokenCount := 0, 0
 	for i, text := range chunkTexts {
-		estTokens := estimateTokens(text)
-		if tokenCount+estTokens > tokenLimit {
-			if err := flushBatch(); err != nil {
+		estTokens := CountTokens(provider.Model, text)
+		if i > batchStart && tokenCount+estTokens > tokenLimit {
+			if err := tagBatch(batchStart, i); err != nil {
 				return nil, err
 			}
-			tokenCount = 0
+			batchStart, tokenCount = i, 0
 		}
-
-		line := fmt.Sprintf("%d. %s\n", i+1, text)
-		inputBuilder.WriteString(line)
 		tokenCount += estTokens
-		currentBatch = append(currentBatch, text)
 	}
 
-	if err := flushBatch(); err != nil {
+	if err := tagBatch(batchStart, len(chunkTexts)); err != nil {
 		return nil, err
 	}
 
 	return allTags, nil
 }
 
-// ParseBatchTags processes the entire raw output string in one pass using runes.
-func ParseBatchTags(input string) [][]string {
-	lines := strings.Split(strings.TrimSpace(input), "\n")
-	var result [][]string
+// buildTagMessage numbers the texts from 1, the keys the model must answer with.
+func buildTagMessage(texts []string) string {
+	var builder strings.Builder
+	for i, text := range texts {
+		builder.WriteString(fmt.Sprintf("%d. %s\n", i+1, text))
+	}
+	return builder.String()
+}
+
+// ParseBatchTags decodes a JSON tag response keyed by chunk number.
+// It fails unless there is exactly one entry for each of the count chunks.
+func ParseBatchTags(input string, count int) ([][]string, error) {
+	input = strings.TrimSpace(input)
+	// Tolerate a preamble or code fence around the object.
+	start, end := strings.Index(input, "{"), strings.LastIndex(input, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no JSON object in response")
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal([]byte(input[start:end+1]), &raw); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	// Some models wrap the object, e.g. {"tags": {"1": [...]}}. A single key that isn't a
+	// chunk number can only be such a wrapper, whatever the count.
+	if len(raw) == 1 {
+		for key, value := range raw {
+			if _, err := strconv.Atoi(strings.TrimSpace(key)); err == nil {
+				break
+			}
+			if nested, ok := value.(map[string]interface{}); ok {
+				raw = nested
+			}
+		}
+	}
+
+	if len(raw) != count {
+		return nil, fmt.Errorf("expected %d tag groups, got %d", count, len(raw))
+	}
 
-	for _, line := range lines {
-		line = strings.TrimSpace(prefixRegex.ReplaceAllString(line, ""))
-		if line == "" {
-			continue
+	result := make([][]string, count)
+	for key, value := range raw {
+		index, err := strconv.Atoi(strings.TrimSpace(key))
+		if err != nil || index < 1 || index > count {
+			return nil, fmt.Errorf("unexpected chunk key %q", key)
+		}
+		if result[index-1] != nil {
+			return nil, fmt.Errorf("duplicate chunk key %q", key)
 		}
-		parts := strings.Split(line, "|")
-		var tags []string
-		for _, part := range parts {
-			tag := strings.TrimSpace(part)
-			if tag != "" {
-				tags = append(tags, tag)
+		result[index-1] = normalizeTagValue(value)
+	}
+
+	return result, nil
+}
+
+// normalizeTagValue accepts a list of tags or a single '|' separated string.
+func normalizeTagValue(value interface{}) []string {
+	var parts []string
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if tag, ok := item.(string); ok {
+				parts = append(parts, tag)
 			}
 		}
-		result = append(result, tags)
+	case string:
+		parts = strings.Split(v, "|")
 	}
 
-	return result
+	tags := []string{}
+	for _, part := range parts {
+		tag := strings.TrimSpace(part)
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
 }
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseBatchTags(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		count int
+		want  [][]string
+		ok    bool
+	}{
+		{"plain", `{"1": ["a", "b"], "2": ["c"]}`, 2, [][]string{{"a", "b"}, {"c"}}, true},
+		{"pipe string", `{"1": "a | b |"}`, 1, [][]string{{"a", "b"}}, true},
+		{"wrapped", `{"tags": {"1": ["a"], "2": ["b"]}}`, 2, [][]string{{"a"}, {"b"}}, true},
+		{"wrapped single chunk", `{"tags": {"1": ["a"]}}`, 1, [][]string{{"a"}}, true},
+		{"preamble and fence", "Here are the tags:\n```json\n{\"1\": [\"a\"], \"2\": []}\n```", 2, [][]string{{"a"}, {}}, true},
+		{"spaced keys", `{" 1 ": ["a"], "2": ["b"]}`, 2, [][]string{{"a"}, {"b"}}, true},
+		{"missing key", `{"1": ["a"], "3": ["c"]}`, 2, nil, false},
+		{"too few", `{"1": ["a"]}`, 2, nil, false},
+		{"duplicate key", `{"1": ["a"], "01": ["b"]}`, 2, nil, false},
+		{"repeated key", `{"1": ["a"], "1": ["b"]}`, 2, nil, false},
+		{"wrapped single with wrong count", `{"tags": {"1": ["a"]}}`, 2, nil, false},
+		{"not an object", `["a", "b"]`, 1, nil, false},
+		{"invalid JSON", `{"1": [}`, 1, nil, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseBatchTags(test.input, test.count)
+			if (err == nil) != test.ok {
+				t.Fatalf("ParseBatchTags err = %v, want ok %v", err, test.ok)
+			}
+			if test.ok && !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ParseBatchTags = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
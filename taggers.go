@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const keywordTagsPerChunk = 5
+
+// Tagger assigns tags to a batch of texts, returning one tag list per text in order.
+type Tagger interface {
+	Name() string
+	Tag(ctx context.Context, texts []string) ([][]string, error)
+}
+
+// LLMTagger asks an OpenAI-compatible chat model for tags, skipping texts found in the tag cache.
+type LLMTagger struct {
+	name     string
+	Provider ChatProvider
+	Language string // Canonical tag language, empty keeps the text's own
+}
+
+func (t LLMTagger) Name() string { return t.name }
+
+func (t LLMTagger) Tag(ctx context.Context, texts []string) ([][]string, error) {
+	result := make([][]string, len(texts))
+	var missing []string
+	var missingIndexes []int
+	for i, text := range texts {
+		if tags, ok := tagCache.Get(t.Provider.Model, t.Language, text); ok {
+			result[i] = tags
+			continue
+		}
+		missing = append(missing, text)
+		missingIndexes = append(missingIndexes, i)
+	}
+	if len(missing) == 0 {
+		return result, nil
+	}
+
+	if os.Getenv(t.Provider.APIKeyEnv) == "" {
+		return nil, fmt.Errorf("%s not set", t.Provider.APIKeyEnv)
+	}
+	tags, err := BatchGenerateTags(ctx, t.Provider, t.Language, missing)
+	if err != nil {
+		return nil, err
+	}
+
+	for j, i := range missingIndexes {
+		result[i] = tags[j]
+		// An empty list means the model's answer couldn't be used, so ask again next time.
+		if len(tags[j]) > 0 {
+			tagCache.Put(t.Provider.Model, t.Language, missing[j], tags[j])
+		}
+	}
+	return result, nil
+}
+
+// KeywordTagger extracts tags offline: RAKE-style candidate phrases, weighted by
+// how rare their words are across the batch (IDF).
+type KeywordTagger struct{}
+
+func (KeywordTagger) Name() string { return "keyword" }
+
+func (KeywordTagger) Tag(ctx context.Context, texts []string) ([][]string, error) {
+	// Document frequency of every word across the batch.
+	docFreq := map[string]int{}
+	for _, text := range texts {
+		seen := map[string]bool{}
+		for _, word := range keywordTokens(text) {
+			if !seen[word] {
+				seen[word] = true
+				docFreq[word]++
+			}
+		}
+	}
+
+	result := make([][]string, len(texts))
+	for i, text := range texts {
+		result[i] = extractKeywords(text, docFreq, len(texts))
+	}
+	return result, nil
+}
+
+// NoopTagger leaves chunks untagged.
+type NoopTagger struct{}
+
+func (NoopTagger) Name() string { return "none" }
+
+func (NoopTagger) Tag(ctx context.Context, texts []string) ([][]string, error) {
+	result := make([][]string, len(texts))
+	for i := range result {
+		result[i] = []string{}
+	}
+	return result, nil
+}
+
+// openAITaggerProvider is configured with TAGGER_OPENAI_URL, TAGGER_OPENAI_MODEL and TAGGER_OPENAI_API_KEY_ENV.
+func openAITaggerProvider() ChatProvider {
+	provider := ChatProvider{
+		URL:       "https://api.openai.com/v1/chat/completions",
+		Model:     "gpt-4o-mini",
+		APIKeyEnv: "OPENAI_API_KEY",
+	}
+	if url := os.Getenv("TAGGER_OPENAI_URL"); url != "" {
+		provider.URL = url
+	}
+	if model := os.Getenv("TAGGER_OPENAI_MODEL"); model != "" {
+		provider.Model = model
+	}
+	if keyEnv := os.Getenv("TAGGER_OPENAI_API_KEY_ENV"); keyEnv != "" {
+		provider.APIKeyEnv = keyEnv
+	}
+	return provider
+}
+
+// TaggerByName returns the tagger for a request; empty picks CHISEL_TAGGER, or groq.
+// LLM taggers write tags in TAG_LANGUAGE when it is set.
+func TaggerByName(name string) (Tagger, error) {
+	if name == "" {
+		name = os.Getenv("CHISEL_TAGGER")
+	}
+
+	switch name {
+	case "", "groq":
+		return LLMTagger{name: "groq", Provider: groqProvider, Language: os.Getenv("TAG_LANGUAGE")}, nil
+	case "openai":
+		return LLMTagger{name: "openai", Provider: openAITaggerProvider(), Language: os.Getenv("TAG_LANGUAGE")}, nil
+	case "keyword":
+		return KeywordTagger{}, nil
+	case "none":
+		return NoopTagger{}, nil
+	}
+	return nil, fmt.Errorf("unknown tagger %q", name)
+}
+
+func extractKeywords(text string, docFreq map[string]int, docs int) []string {
+	phrases := candidatePhrases(text)
+
+	// RAKE word scores: degree (co-occurrence within phrases) over frequency.
+	freq := map[string]int{}
+	degree := map[string]int{}
+	for _, phrase := range phrases {
+		for _, word := range phrase {
+			freq[word]++
+			degree[word] += len(phrase)
+		}
+	}
+
+	type scored struct {
+		phrase string
+		score  float64
+	}
+	var candidates []scored
+	seen := map[string]bool{}
+	for _, phrase := range phrases {
+		key := strings.Join(phrase, " ")
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		var score float64
+		for _, word := range phrase {
+			idf := math.Log(1 + float64(docs)/float64(1+docFreq[word]))
+			score += float64(degree[word]) / float64(freq[word]) * (1 + idf)
+		}
+		candidates = append(candidates, scored{phrase: key, score: score})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+
+	tags := []string{}
+	for _, candidate := range candidates {
+		if len(tags) >= keywordTagsPerChunk {
+			break
+		}
+		tags = append(tags, candidate.phrase)
+	}
+	return tags
+}
+
+// candidatePhrases splits text into runs of content words, broken at stopwords and punctuation.
+func candidatePhrases(text string) [][]string {
+	var phrases [][]string
+	var current []string
+
+	flush := func() {
+		// Long runs are usually sentence fragments, so cut them into short phrases.
+		for len(current) > 3 {
+			phrases = append(phrases, current[:3])
+			current = current[3:]
+		}
+		if len(current) > 0 {
+			phrases = append(phrases, current)
+		}
+		current = nil
+	}
+
+	for _, field := range strings.Fields(strings.ToLower(text)) {
+		word := strings.TrimFunc(field, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		})
+		// Trailing punctuation such as a comma or full stop ends the phrase.
+		breaksAfter := strings.TrimRightFunc(field, unicode.IsPunct) != field
+
+		if word == "" || stopwords[word] || len([]rune(word)) < 3 || isNumeric(word) {
+			flush()
+			continue
+		}
+		current = append(current, word)
+		if breaksAfter {
+			flush()
+		}
+	}
+	flush()
+
+	return phrases
+}
+
+func keywordTokens(text string) []string {
+	var words []string
+	for _, phrase := range candidatePhrases(text) {
+		words = append(words, phrase...)
+	}
+	return words
+}
+
+func isNumeric(word string) bool {
+	for _, r := range word {
+		if !unicode.IsNumber(r) {
+			return false
+		}
+	}
+	return true
+}
+
+var stopwords = map[string]bool{}
+
+func init() {
+	for _, word := range strings.Fields(`a about above after again against all also am an and any are as at be
+		because been before being below between both but by can could did do does doing down during each
+		few for from further had has have having he her here hers herself him himself his how however i if
+		in into is it its itself just let like may me might more most must my myself no nor not now of off
+		on once one only or other our ours ourselves out over own same shall she should so some such than
+		that the their theirs them themselves then there these they this those through thus to too under
+		until up upon us very was we were what when where whether which while who whom whose why will with
+		within without would yet you your yours yourself yourselves`) {
+		stopwords[word] = true
+	}
+}
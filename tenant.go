@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+)
+
+// Points are partitioned between tenants by this payload field. Collections stay
+// shared; every search, scroll, count, update and delete made for a tenant is
+// filtered on it, and every write stamps it.
+const tenantField = "tenant_id"
+
+const tenantHeader = "X-Tenant-ID"
+
+var validTenant = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+
+// With auth on, every non-admin key must act for a tenant; TENANT_REQUIRED=false lets
+// keys without one act untenanted. With auth off the tenant is always optional.
+// Points written before tenancy have no tenant_id and are only seen untenanted
+// until POST /collections/{name}/tenant assigns them one.
+var tenantRequired = os.Getenv("TENANT_REQUIRED") != "false"
+
+var (
+	errTenantInvalid   = errors.New("invalid tenant")
+	errTenantMismatch  = errors.New("tenant does not match the key's tenant")
+	errTenantUnbound   = errors.New("key is not bound to a tenant")
+	errTenantForbidden = errors.New("only admin keys may pick a tenant with " + tenantHeader)
+)
+
+type tenantKey struct{}
+
+// TenantFrom returns the tenant a request acts for, "" for none.
+func TenantFrom(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// requestTenant works out the tenant of a request. A key bound to a tenant always
+// acts for it. Only admin keys, or any caller while auth is off, may pick one with
+// the X-Tenant-ID header; those that don't act untenanted.
+func requestTenant(r *http.Request, id *Identity) (string, error) {
+	tenant := r.Header.Get(tenantHeader)
+	if tenant != "" && !validTenant.MatchString(tenant) {
+		return "", fmt.Errorf("%w %q", errTenantInvalid, tenant)
+	}
+
+	switch {
+	case id == nil:
+		return tenant, nil
+	case id.Tenant != "":
+		if tenant != "" && tenant != id.Tenant {
+			return "", errTenantMismatch
+		}
+		return id.Tenant, nil
+	case id.HasScope(scopeAdmin):
+		return tenant, nil
+	case tenant != "":
+		return "", errTenantForbidden
+	case tenantRequired:
+		return "", fmt.Errorf("%w: %q", errTenantUnbound, id.Name)
+	}
+	return "", nil
+}
+
+// authorizeUntenanted writes a 403 and returns false for tenant requests, for
+// operations on whole collections that would reach other tenants' points.
+func authorizeUntenanted(w http.ResponseWriter, r *http.Request, action string) bool {
+	if tenant := TenantFrom(r.Context()); tenant != "" {
+		http.Error(w, fmt.Sprintf("Tenant %q may not %s: collections are shared between tenants", tenant, action), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// tenantFilter ANDs the context's tenant into filter. Without a tenant the filter is returned as is.
+func tenantFilter(ctx context.Context, filter map[string]interface{}) map[string]interface{} {
+	tenant := TenantFrom(ctx)
+	if tenant == "" {
+		return filter
+	}
+	scoped := BuildFilter(FilterParams{TenantID: tenant})
+	if filter != nil {
+		scoped["must"] = append(scoped["must"].([]map[string]interface{}), filter)
+	}
+	return scoped
+}
+
+// pointsSelector selects points by ID, limited to the context's tenant.
+func pointsSelector(ctx context.Context, ids []interface{}) map[string]interface{} {
+	if TenantFrom(ctx) == "" {
+		return map[string]interface{}{"points": ids}
+	}
+	return map[string]interface{}{
+		"filter": tenantFilter(ctx, map[string]interface{}{
+			"must": []map[string]interface{}{{"has_id": ids}},
+		}),
+	}
+}
+
+// claimTenantPoints stamps the context's tenant on points about to be upserted and
+// refuses IDs that already belong to another tenant, which an upsert would overwrite.
+func claimTenantPoints(ctx context.Context, collection string, points []map[string]interface{}) error {
+	tenant := TenantFrom(ctx)
+	if tenant == "" {
+		return nil
+	}
+
+	ids := make([]interface{}, 0, len(points))
+	for i, point := range points {
+		payload, _ := point["payload"].(map[string]interface{})
+		if payload == nil {
+			payload = map[string]interface{}{}
+		}
+		payload[tenantField] = tenant
+		points[i]["payload"] = payload
+		ids = append(ids, point["id"])
+	}
+
+	url := fmt.Sprintf("%s/collections/%s/points", qdrantBaseURL, collection)
+	body, err := json.Marshal(map[string]interface{}{
+		"ids":          ids,
+		"with_payload": map[string]interface{}{"include": []string{tenantField}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal point lookup: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(body))
+	if err != nil {
+		return fmt.Errorf("failed to create point lookup: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := DoUpstream(req, qdrantPolicy)
+	if err != nil {
+		return fmt.Errorf("failed to look up points: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("qdrant point lookup failed: %s", resp.Status)
+	}
+
+	var response struct {
+		Result []SearchHit `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("failed to decode point lookup: %w", err)
+	}
+	for _, existing := range response.Result {
+		if payloadString(existing.Payload, tenantField) != tenant {
+			return fmt.Errorf("%w: point %v belongs to another tenant", errForeignPoint, existing.ID)
+		}
+	}
+	return nil
+}
+
+var errForeignPoint = errors.New("point not owned by tenant")
+
+// untenantedFilter matches points that carry no tenant, such as those written
+// before tenancy was introduced.
+var untenantedFilter = map[string]interface{}{
+	"must": []map[string]interface{}{{"is_empty": map[string]interface{}{"key": tenantField}}},
+}
+
+// AssignTenant stamps tenant on every point of a collection that has none and
+// returns how many points that was.
+func AssignTenant(ctx context.Context, collection, tenant string) (int, error) {
+	count, err := CountQdrantPoints(ctx, collection, untenantedFilter)
+	if err != nil || count == 0 {
+		return 0, err
+	}
+
+	url := fmt.Sprintf("%s/collections/%s/points/payload?wait=true", qdrantBaseURL, collection)
+	body, err := json.Marshal(map[string]interface{}{
+		"payload": map[string]interface{}{tenantField: tenant},
+		"filter":  untenantedFilter,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal tenant assignment: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create tenant assignment: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := DoUpstream(req, qdrantPolicy)
+	if err != nil {
+		return 0, fmt.Errorf("failed to assign tenant: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return 0, fmt.Errorf("qdrant tenant assignment failed: %s: %s", resp.Status, string(respBody))
+	}
+	return count, nil
+}
+
+// assignTenantHandler backfills a tenant onto a collection's untenanted points,
+// so they stay visible once clients start sending a tenant.
+func assignTenantHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var payload struct {
+		TenantID string `json:"tenant_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if !validTenant.MatchString(payload.TenantID) {
+		http.Error(w, fmt.Sprintf("%v %q", errTenantInvalid, payload.TenantID), http.StatusBadRequest)
+		return
+	}
+
+	name := r.PathValue("name")
+	if !authorizeCollections(w, r, name) || !authorizeUntenanted(w, r, "assign tenants") {
+		return
+	}
+	collection := registry.Resolve(name)
+
+	assigned, err := AssignTenant(r.Context(), collection, payload.TenantID)
+	if errors.Is(err, ErrCollectionNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to assign tenant: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"collection": collection,
+		"tenant_id":  payload.TenantID,
+		"assigned":   assigned,
+	})
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestTenant(t *testing.T) {
+	admin := &Identity{Name: "ops", Scopes: []string{scopeAdmin}}
+	writer := &Identity{Name: "ingest", Scopes: []string{scopeWrite}}
+	bound := &Identity{Name: "acme", Scopes: []string{scopeWrite}, Tenant: "acme"}
+
+	tests := []struct {
+		name     string
+		id       *Identity
+		header   string
+		required bool
+		tenant   string
+		err      error
+	}{
+		{"bound key", bound, "", true, "acme", nil},
+		{"bound key, same header", bound, "acme", true, "acme", nil},
+		{"bound key, other header", bound, "globex", true, "", errTenantMismatch},
+		{"admin picks tenant", admin, "globex", true, "globex", nil},
+		{"admin untenanted", admin, "", true, "", nil},
+		{"unbound key picks tenant", writer, "globex", true, "", errTenantForbidden},
+		{"unbound key picks tenant, not required", writer, "globex", false, "", errTenantForbidden},
+		{"unbound key", writer, "", true, "", errTenantUnbound},
+		{"unbound key, not required", writer, "", false, "", nil},
+		{"auth off picks tenant", nil, "globex", true, "globex", nil},
+		{"auth off without header", nil, "", true, "", nil},
+		{"auth off, not required", nil, "", false, "", nil},
+		{"invalid header", admin, "../x", true, "", errTenantInvalid},
+	}
+	saved := tenantRequired
+	t.Cleanup(func() { tenantRequired = saved })
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tenantRequired = test.required
+			r := httptest.NewRequest("GET", "/lookup", nil)
+			if test.header != "" {
+				r.Header.Set(tenantHeader, test.header)
+			}
+			tenant, err := requestTenant(r, test.id)
+			if tenant != test.tenant || !errors.Is(err, test.err) {
+				t.Errorf("requestTenant = %q, %v, want %q, %v", tenant, err, test.tenant, test.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+const defaultTokenizerDir = "tokenizers"
+
+// Tokenizer is a byte-level BPE tokenizer compatible with OpenAI's cl100k_base and
+// o200k_base encodings. The merge ranks are read from the published .tiktoken files
+// in TOKENIZER_DIR (e.g. tokenizers/cl100k_base.tiktoken); the dockerfile downloads them.
+type Tokenizer struct {
+	name        string
+	ranks       map[string]int
+	pretokenize func(runes []rune, i int) int // End of the piece starting at i
+}
+
+var tokenizers = struct {
+	sync.Mutex
+	loaded map[string]*Tokenizer // nil entries mark encodings that failed to load
+}{loaded: map[string]*Tokenizer{}}
+
+// encodingForModel picks the encoding of an OpenAI model. Other providers' models
+// (e.g. Llama on Groq) use their own vocabularies; cl100k is a close stand-in.
+func encodingForModel(model string) string {
+	for _, prefix := range []string{"gpt-4o", "gpt-4.1", "gpt-5", "o1", "o3", "o4"} {
+		if strings.HasPrefix(model, prefix) {
+			return "o200k_base"
+		}
+	}
+	return "cl100k_base"
+}
+
+// TokenizerFor returns the tokenizer for a model, or nil if its ranks are unavailable.
+func TokenizerFor(model string) *Tokenizer {
+	encoding := encodingForModel(model)
+
+	tokenizers.Lock()
+	defer tokenizers.Unlock()
+
+	if tokenizer, ok := tokenizers.loaded[encoding]; ok {
+		return tokenizer
+	}
+
+	dir := os.Getenv("TOKENIZER_DIR")
+	if dir == "" {
+		dir = defaultTokenizerDir
+	}
+	tokenizer, err := LoadTokenizer(encoding, filepath.Join(dir, encoding+".tiktoken"))
+	if err != nil {
+		log.Printf("Tokenizer %s unavailable, estimating token counts: %v", encoding, err)
+	}
+	tokenizers.loaded[encoding] = tokenizer
+	return tokenizer
+}
+
+// LoadTokenizer reads a .tiktoken file: one base64 token and its rank per line.
+func LoadTokenizer(encoding, path string) (*Tokenizer, error) {
+	var pretokenize func([]rune, int) int
+	switch encoding {
+	case "cl100k_base":
+		pretokenize = cl100kPiece
+	case "o200k_base":
+		pretokenize = o200kPiece
+	default:
+		return nil, fmt.Errorf("unsupported encoding %q", encoding)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	ranks := map[string]int{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		token, rank, ok := strings.Cut(strings.TrimSpace(scanner.Text()), " ")
+		if !ok {
+			continue
+		}
+		bytes, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return nil, fmt.Errorf("invalid token %q in %s: %w", token, path, err)
+		}
+		value, err := strconv.Atoi(rank)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rank %q in %s: %w", rank, path, err)
+		}
+		ranks[string(bytes)] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(ranks) < 256 {
+		return nil, fmt.Errorf("%s has only %d tokens", path, len(ranks))
+	}
+
+	return &Tokenizer{name: encoding, ranks: ranks, pretokenize: pretokenize}, nil
+}
+
+// Encode returns the token ids of text.
+func (t *Tokenizer) Encode(text string) []int {
+	var tokens []int
+	t.encode(text, func(rank, _ int) { tokens = append(tokens, rank) })
+	return tokens
+}
+
+// encode calls emit with every token and the byte offset in text where it ends.
+func (t *Tokenizer) encode(text string, emit func(rank, end int)) {
+	runes := []rune(text)
+	offset := 0
+	for i := 0; i < len(runes); {
+		end := t.pretokenize(runes, i)
+		piece := string(runes[i:end])
+		t.bytePairEncode(piece, func(rank, pieceEnd int) { emit(rank, offset+pieceEnd) })
+		offset += len(piece)
+		i = end
+	}
+}
+
+// bytePairEncode repeatedly merges the adjacent pair with the lowest rank.
+func (t *Tokenizer) bytePairEncode(piece string, emit func(rank, end int)) {
+	if rank, ok := t.ranks[piece]; ok {
+		emit(rank, len(piece))
+		return
+	}
+
+	bounds := make([]int, len(piece)+1) // Token start offsets, then len(piece)
+	for i := range bounds {
+		bounds[i] = i
+	}
+	for len(bounds) > 2 {
+		best, bestRank := -1, math.MaxInt
+		for i := 0; i+2 < len(bounds); i++ {
+			if rank, ok := t.ranks[piece[bounds[i]:bounds[i+2]]]; ok && rank < bestRank {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		bounds = append(bounds[:best+1], bounds[best+2:]...)
+	}
+
+	for i := 0; i+1 < len(bounds); i++ {
+		emit(t.ranks[piece[bounds[i]:bounds[i+1]]], bounds[i+1])
+	}
+}
+
+// CountTokens counts text's tokens for model, estimating when no tokenizer is available.
+func CountTokens(model, text string) int {
+	tokenizer := TokenizerFor(model)
+	if tokenizer == nil {
+		return estimateTokens(text)
+	}
+	count := 0
+	tokenizer.encode(text, func(_, _ int) { count++ })
+	return count
+}
+
+// SplitTokens cuts text into pieces of at most max tokens for model. Cuts fall on
+// token boundaries that are also character boundaries, so no piece holds half a rune.
+func SplitTokens(model, text string, max int) []string {
+	tokenizer := TokenizerFor(model)
+	if tokenizer == nil {
+		return splitEstimated(text, max)
+	}
+
+	var pieces []string
+	start, count := 0, 0
+	lastSafe, lastSafeCount := 0, 0 // Latest cut point inside the current piece
+	tokenizer.encode(text, func(_, end int) {
+		count++
+		if count > max && lastSafe > start {
+			pieces = append(pieces, text[start:lastSafe])
+			start, count = lastSafe, count-lastSafeCount
+		}
+		if end == len(text) || utf8.RuneStart(text[end]) {
+			lastSafe, lastSafeCount = end, count
+		}
+	})
+	if start < len(text) {
+		pieces = append(pieces, text[start:])
+	}
+	return pieces
+}
+
+// splitEstimated is SplitTokens without a tokenizer: about four bytes per token, cut at spaces.
+func splitEstimated(text string, max int) []string {
+	limit := max * 4
+	var pieces []string
+	for len(text) > limit {
+		cut := strings.LastIndexFunc(text[:limit], unicode.IsSpace)
+		if cut <= 0 {
+			cut = limit
+			for cut > 0 && !utf8.RuneStart(text[cut]) {
+				cut--
+			}
+		}
+		pieces = append(pieces, text[:cut])
+		text = text[cut:]
+	}
+	if text != "" {
+		pieces = append(pieces, text)
+	}
+	return pieces
+}
+
+// TruncateTokens returns the first max tokens of text.
+func TruncateTokens(model, text string, max int) string {
+	pieces := SplitTokens(model, text, max)
+	if len(pieces) == 0 {
+		return text
+	}
+	return pieces[0]
+}
+
+// The pretokenizers below hand-implement the split patterns of tiktoken, whose
+// lookaheads Go's regexp package cannot express.
+
+func isNewline(r rune) bool { return r == '\r' || r == '\n' }
+
+// [^\r\n\p{L}\p{N}]
+func isWordPrefix(r rune) bool {
+	return !isNewline(r) && !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
+
+// [^\s\p{L}\p{N}]
+func isSymbol(r rune) bool {
+	return !unicode.IsSpace(r) && !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
+
+// contractionEnd matches (?i:'s|'t|'re|'ve|'m|'ll|'d) at i, returning -1 if it doesn't.
+func contractionEnd(runes []rune, i int) int {
+	if i+1 >= len(runes) || runes[i] != '\'' {
+		return -1
+	}
+	switch unicode.ToLower(runes[i+1]) {
+	case 's', 't', 'm', 'd':
+		return i + 2
+	case 'r', 'v':
+		if i+2 < len(runes) && unicode.ToLower(runes[i+2]) == 'e' {
+			return i + 3
+		}
+	case 'l':
+		if i+2 < len(runes) && unicode.ToLower(runes[i+2]) == 'l' {
+			return i + 3
+		}
+	}
+	return -1
+}
+
+// cl100kPiece implements
+// (?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+
+func cl100kPiece(runes []rune, i int) int {
+	n := len(runes)
+	if end := contractionEnd(runes, i); end > 0 {
+		return end
+	}
+
+	j := i
+	if isWordPrefix(runes[i]) && i+1 < n && unicode.IsLetter(runes[i+1]) {
+		j++
+	}
+	if unicode.IsLetter(runes[j]) {
+		for j < n && unicode.IsLetter(runes[j]) {
+			j++
+		}
+		return j
+	}
+
+	if end := numberEnd(runes, i); end > 0 {
+		return end
+	}
+	if end := symbolEnd(runes, i, isNewline); end > 0 {
+		return end
+	}
+	return whitespaceEnd(runes, i)
+}
+
+// [\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]
+func isUpperish(r rune) bool {
+	return unicode.In(r, unicode.Lu, unicode.Lt, unicode.Lm, unicode.Lo, unicode.M)
+}
+
+// [\p{Ll}\p{Lm}\p{Lo}\p{M}]
+func isLowerish(r rune) bool {
+	return unicode.In(r, unicode.Ll, unicode.Lm, unicode.Lo, unicode.M)
+}
+
+// o200kPiece implements
+// [^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?|
+// [^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?|
+// \p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n/]*|\s*[\r\n]+|\s+(?!\S)|\s+
+func o200kPiece(runes []rune, i int) int {
+	n := len(runes)
+	starts := []int{i}
+	if isWordPrefix(runes[i]) && i+1 < n {
+		starts = []int{i + 1, i}
+	}
+
+	withContraction := func(end int) int {
+		if after := contractionEnd(runes, end); after > 0 {
+			return after
+		}
+		return end
+	}
+
+	// Upper* Lower+, backtracking the greedy upper run until a lower rune follows.
+	for _, p := range starts {
+		q := p
+		for q < n && isUpperish(runes[q]) {
+			q++
+		}
+		for k := q; k >= p; k-- {
+			if k < n && isLowerish(runes[k]) {
+				end := k
+				for end < n && isLowerish(runes[end]) {
+					end++
+				}
+				return withContraction(end)
+			}
+		}
+	}
+
+	// Upper+ Lower*
+	for _, p := range starts {
+		q := p
+		for q < n && isUpperish(runes[q]) {
+			q++
+		}
+		if q > p {
+			for q < n && isLowerish(runes[q]) {
+				q++
+			}
+			return withContraction(q)
+		}
+	}
+
+	if end := numberEnd(runes, i); end > 0 {
+		return end
+	}
+	if end := symbolEnd(runes, i, func(r rune) bool { return isNewline(r) || r == '/' }); end > 0 {
+		return end
+	}
+	return whitespaceEnd(runes, i)
+}
+
+// \p{N}{1,3}
+func numberEnd(runes []rune, i int) int {
+	j := i
+	for j < len(runes) && j < i+3 && unicode.IsNumber(runes[j]) {
+		j++
+	}
+	if j == i {
+		return -1
+	}
+	return j
+}
+
+// ` ?[^\s\p{L}\p{N}]+` followed by any run of trailing runes.
+func symbolEnd(runes []rune, i int, trailing func(rune) bool) int {
+	n := len(runes)
+	j := i
+	if runes[j] == ' ' && j+1 < n && isSymbol(runes[j+1]) {
+		j++
+	}
+	if !isSymbol(runes[j]) {
+		return -1
+	}
+	for j < n && isSymbol(runes[j]) {
+		j++
+	}
+	for j < n && trailing(runes[j]) {
+		j++
+	}
+	return j
+}
+
+// \s*[\r\n]+|\s+(?!\S)|\s+
+func whitespaceEnd(runes []rune, i int) int {
+	j := i
+	for j < len(runes) && unicode.IsSpace(runes[j]) {
+		j++
+	}
+	if j == i {
+		return i + 1
+	}
+	// Up to and including the last line break of the run.
+	for k := j - 1; k >= i; k-- {
+		if isNewline(runes[k]) {
+			return k + 1
+		}
+	}
+	// Leave the last space to prefix the following word.
+	if j == len(runes) || j-i == 1 {
+		return j
+	}
+	return j - 1
+}
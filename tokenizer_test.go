@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func pieces(pretokenize func([]rune, int) int, text string) []string {
+	runes := []rune(text)
+	var result []string
+	for i := 0; i < len(runes); {
+		end := pretokenize(runes, i)
+		result = append(result, string(runes[i:end]))
+		i = end
+	}
+	return result
+}
+
+// Expected pieces follow tiktoken's cl100k_base and o200k_base split patterns.
+func TestPretokenizers(t *testing.T) {
+	tests := []struct {
+		name   string
+		split  func([]rune, int) int
+		text   string
+		pieces []string
+	}{
+		{"cl100k words", cl100kPiece, "hello world", []string{"hello", " world"}},
+		{"cl100k arithmetic", cl100kPiece, "2 + 2 = 4", []string{"2", " +", " ", "2", " =", " ", "4"}},
+		{"cl100k contraction and digits", cl100kPiece, "I'm 12345 ok\n\nbye", []string{"I", "'m", " ", "123", "45", " ok", "\n\n", "bye"}},
+		{"cl100k trailing spaces", cl100kPiece, "a   b", []string{"a", "  ", " b"}},
+		{"cl100k punctuation", cl100kPiece, "great!", []string{"great", "!"}},
+		{"o200k words", o200kPiece, "hello world", []string{"hello", " world"}},
+		{"o200k camel case", o200kPiece, "I'm HelloWorld", []string{"I'm", " Hello", "World"}},
+		{"o200k arithmetic", o200kPiece, "2 + 2 = 4", []string{"2", " +", " ", "2", " =", " ", "4"}},
+		{"o200k slash after symbol", o200kPiece, "a ://b", []string{"a", " ://", "b"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := pieces(test.split, test.text); !reflect.DeepEqual(got, test.pieces) {
+				t.Errorf("pieces(%q) = %q, want %q", test.text, got, test.pieces)
+			}
+		})
+	}
+}
+
+func TestBytePairEncodeMergesLowestRankFirst(t *testing.T) {
+	ranks := map[string]int{}
+	for b := 0; b < 256; b++ {
+		ranks[string([]byte{byte(b)})] = b
+	}
+	ranks["he"], ranks["ll"], ranks["hell"], ranks["hello"], ranks["lo"] = 256, 257, 258, 259, 300
+	tokenizer := &Tokenizer{name: "test", ranks: ranks, pretokenize: cl100kPiece}
+
+	tests := map[string][]int{
+		"hello":      {259},
+		"hellx":      {258, 'x'},
+		"halo":       {'h', 'a', 300},
+		"hello hell": {259, ' ', 258},
+	}
+	for text, want := range tests {
+		if got := tokenizer.Encode(text); !reflect.DeepEqual(got, want) {
+			t.Errorf("Encode(%q) = %v, want %v", text, got, want)
+		}
+	}
+}
+
+// Token ids as produced by the tiktoken Python package.
+func TestEncodeMatchesTiktoken(t *testing.T) {
+	tests := []struct {
+		encoding string
+		text     string
+		tokens   []int
+	}{
+		{"cl100k_base", "hello world", []int{15339, 1917}},
+		{"cl100k_base", "tiktoken is great!", []int{83, 1609, 5963, 374, 2294, 0}},
+		{"cl100k_base", "antidisestablishmentarianism", []int{519, 85342, 34500, 479, 8997, 2191}},
+		{"cl100k_base", "2 + 2 = 4", []int{17, 489, 220, 17, 284, 220, 19}},
+		{"cl100k_base", "お誕生日おめでとう", []int{33334, 45918, 243, 21990, 9080, 33334, 62004, 16556, 78699}},
+		{"o200k_base", "tiktoken is great!", []int{83, 8251, 2488, 382, 2212, 0}},
+		{"o200k_base", "antidisestablishmentarianism", []int{493, 129901, 376, 160388, 21203}},
+		{"o200k_base", "2 + 2 = 4", []int{17, 659, 220, 17, 314, 220, 19}},
+		{"o200k_base", "お誕生日おめでとう", []int{8930, 9697, 243, 128225, 8930, 17693, 4344, 48669}},
+	}
+
+	dir := os.Getenv("TOKENIZER_DIR")
+	if dir == "" {
+		dir = defaultTokenizerDir
+	}
+	loaded := map[string]*Tokenizer{}
+	for _, test := range tests {
+		tokenizer, ok := loaded[test.encoding]
+		if !ok {
+			var err error
+			tokenizer, err = LoadTokenizer(test.encoding, filepath.Join(dir, test.encoding+".tiktoken"))
+			if err != nil {
+				t.Skipf("rank files not available, run the download in the dockerfile first: %v", err)
+			}
+			loaded[test.encoding] = tokenizer
+		}
+		if got := tokenizer.Encode(test.text); !reflect.DeepEqual(got, test.tokens) {
+			t.Errorf("%s Encode(%q) = %v, want %v", test.encoding, test.text, got, test.tokens)
+		}
+	}
+}